@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	cpCmd = &cobra.Command{
+		Use:   "cp [-r] <src> <ID>:<dst> | <ID>:<src> <dst>",
+		Short: "Copy files between the host and a running VM",
+		Long:  "Copy files between the host and a running VM over SFTP, a - source or destination is a tar stream on stdin or stdout",
+		Args:  cobra.ExactArgs(2),
+		RunE:  doCp,
+	}
+
+	cpRecursive bool
+)
+
+func init() {
+	RootCmd.AddCommand(cpCmd)
+	cpCmd.Flags().BoolVarP(&cpRecursive, "recursive", "r", false, "Copy directories recursively")
+}
+
+// parseCpPath splits a VM path, <ID>:<path>, the paths without an ID before the colon are local
+func parseCpPath(arg string) (id string, path string, isVM bool) {
+	id, path, found := strings.Cut(arg, ":")
+	if !found || id == "" || strings.ContainsAny(id, `/.\`) {
+		return "", arg, false
+	}
+	// the relative paths are relative to the home directory of the VM user
+	if path == "" {
+		path = "."
+	}
+	return id, path, true
+}
+
+func doCp(flags *cobra.Command, args []string) error {
+	srcId, src, srcIsVM := parseCpPath(args[0])
+	dstId, dst, dstIsVM := parseCpPath(args[1])
+
+	if srcIsVM == dstIsVM {
+		return errors.New("one of the source and the destination must be a path in a VM, <ID>:<path>")
+	}
+
+	id := srcId
+	if dstIsVM {
+		id = dstId
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	state, err := bootcVM.State()
+	if err != nil {
+		return err
+	}
+	if state != vm.StateRunning {
+		return fmt.Errorf("VM %s is %s, not running", id, state)
+	}
+
+	ctx := flags.Context()
+	switch {
+	case dstIsVM && src == "-":
+		err = bootcVM.CopyTarToVM(ctx, os.Stdin, dst)
+	case dstIsVM:
+		err = bootcVM.CopyToVM(ctx, src, dst, cpRecursive)
+	case dst == "-":
+		err = bootcVM.CopyTarFromVM(ctx, os.Stdout, src)
+	default:
+		err = bootcVM.CopyFromVM(ctx, src, dst, cpRecursive)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to copy %s to %s: %w", args[0], args[1], err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestCmd(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Command Test Suite")
+}
+
+var _ = Describe("parseCpPath", func() {
+	DescribeTable("should split the path",
+		func(arg string, id string, path string, isVM bool) {
+			parsedID, parsedPath, parsedIsVM := parseCpPath(arg)
+			Expect(parsedID).To(Equal(id))
+			Expect(parsedPath).To(Equal(path))
+			Expect(parsedIsVM).To(Equal(isVM))
+		},
+		Entry("VM absolute path", "3a7f2ce9b1d0:/etc/hosts", "3a7f2ce9b1d0", "/etc/hosts", true),
+		Entry("VM relative path", "3a7f2ce9b1d0:file", "3a7f2ce9b1d0", "file", true),
+		Entry("VM home directory", "3a7f2ce9b1d0:", "3a7f2ce9b1d0", ".", true),
+		Entry("VM path with a colon", "3a7f2ce9b1d0:/tmp/a:b", "3a7f2ce9b1d0", "/tmp/a:b", true),
+		Entry("local path", "/etc/hosts", "", "/etc/hosts", false),
+		Entry("local relative path", "file", "", "file", false),
+		Entry("stdin", "-", "", "-", false),
+		Entry("local path with a colon in a directory", "/tmp/a:b", "", "/tmp/a:b", false),
+		Entry("local relative path with a colon", "./a:b", "", "./a:b", false),
+		Entry("local parent path with a colon", "../a:b", "", "../a:b", false),
+		Entry("local Windows path", `dir\a:b`, "", `dir\a:b`, false),
+		Entry("empty ID", ":/etc/hosts", "", ":/etc/hosts", false),
+	)
+})
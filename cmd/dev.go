@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/bootc"
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/credentials"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// How many changed files are listed when a rebuild is triggered
+const devMaxListedChanges = 5
+
+var (
+	devCmd = &cobra.Command{
+		Use:   "dev <context>",
+		Short: "Rebuild and reboot a VM on build context changes",
+		Long:  "Rebuild and reboot a VM on build context changes",
+		Args:  cobra.ExactArgs(1),
+		RunE:  doDev,
+	}
+
+	devBuildConfig = buildConfig{Build: true}
+	devPullFlags   = pullFlags{}
+	devUser        string
+	devDebounce    time.Duration
+)
+
+func init() {
+	RootCmd.AddCommand(devCmd)
+	devCmd.Flags().StringVarP(&devBuildConfig.ContainerFile, "file", "f", "", "Containerfile to build (default: Containerfile or Dockerfile in the build context)")
+	devCmd.Flags().StringVarP(&devBuildConfig.Tag, "tag", "t", "", "Name of the built image (default: localhost/<build context directory name>:latest)")
+	devCmd.Flags().StringVarP(&devUser, "user", "u", "root", "--user <user name> (default: root)")
+	devCmd.Flags().DurationVar(&devDebounce, "debounce", 2*time.Second, "Wait for the build context to be unchanged for this long before rebuilding")
+	devPullFlags.addTo(devCmd, "missing")
+}
+
+// devSession keeps track of the VM booted from the last successful build
+type devSession struct {
+	user        user.User
+	machineCtx  context.Context
+	pullOptions utils.PullOptions
+	bootcVM     vm.BootcVM
+	imageId     string
+}
+
+func doDev(flags *cobra.Command, args []string) error {
+	ctx := flags.Context()
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return fmt.Errorf("unable to get user: %w", err)
+	}
+
+	machine, err := utils.GetMachineContext()
+	if err != nil {
+		println(utils.PodmanMachineErrorMessage)
+		logrus.Errorf("failed to connect to podman machine. Is podman machine running?\n%s", err)
+		return err
+	}
+
+	contextDir, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+
+	watcher, err := utils.NewDirWatcher(contextDir, devDebounce)
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	session := &devSession{
+		user:        usr,
+		machineCtx:  machine.Ctx,
+		pullOptions: devPullFlags.pullOptions(flags),
+	}
+	defer session.release()
+
+	trigger := "initial build"
+	for {
+		fmt.Printf("Building %s (%s)\n", contextDir, trigger)
+		if err := session.update(ctx, contextDir); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			logrus.Errorf("%v", err)
+			if session.bootcVM != nil {
+				fmt.Println("Keeping the previous VM, fix the error to rebuild")
+			} else {
+				fmt.Println("Waiting for changes to rebuild")
+			}
+		}
+
+		changed, sshErr, err := session.attach(ctx, watcher)
+		if err != nil {
+			return err
+		}
+		if changed == nil {
+			// the user closed the SSH session, we are done
+			ExitCode, err = utils.WithExitCode(sshErr)
+			return err
+		}
+
+		trigger = describeChanges(changed)
+	}
+}
+
+// update rebuilds the image, and replaces the VM if the image changed
+func (s *devSession) update(ctx context.Context, contextDir string) error {
+	tag, err := buildImage(ctx, s.machineCtx, contextDir, devBuildConfig, s.pullOptions, false)
+	if err != nil {
+		return err
+	}
+
+	// Install compares the image digest with the existing disk, only installing it if it changed
+	bootcDisk := bootc.NewBootcDisk(tag, s.machineCtx, s.user)
+	// the built image is only local
+	bootcDisk.PullOptions = s.pullOptions
+	bootcDisk.PullOptions.Policy = "never"
+	if err := bootcDisk.Install(ctx, false, bootc.DiskImageConfig{}); err != nil {
+		return fmt.Errorf("unable to install bootc image: %w", err)
+	}
+
+	if bootcDisk.GetImageId() == s.imageId {
+		fmt.Println("Image unchanged, keeping the running VM")
+		return nil
+	}
+
+	// the previous image is superseded, drop its VM and disk
+	s.remove()
+
+	fmt.Println("Booting the VM...")
+	return s.boot(ctx, bootcDisk)
+}
+
+func (s *devSession) boot(ctx context.Context, bootcDisk *bootc.BootcDisk) (err error) {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    bootcDisk.GetImageId(),
+		User:       s.user,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+		Ctx:        ctx,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to initialize VM: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			bootcVM.CloseConnection()
+			if err := bootcVM.Unlock(); err != nil {
+				logrus.Warningf("unable to unlock VM %s: %v", bootcDisk.GetImageId(), err)
+			}
+		}
+	}()
+
+	sshIdentityPath, err := credentials.Generatekeys(bootcVM.CacheDir())
+	if err != nil {
+		return fmt.Errorf("unable to generate ssh key: %w", err)
+	}
+
+	sshPort, err := utils.GetFreeLocalTcpPort()
+	if err != nil {
+		return fmt.Errorf("unable to get free port for SSH: %w", err)
+	}
+
+	err = bootcVM.Run(ctx, vm.RunVMParameters{
+		SSHPort:     sshPort,
+		SSHIdentity: sshIdentityPath,
+		VMUser:      devUser,
+		Arch:        bootcDisk.GetArch(),
+	})
+	if err != nil {
+		return fmt.Errorf("runBootcVM: %w", err)
+	}
+
+	if err := bootcVM.WriteConfig(*bootcDisk); err != nil {
+		return err
+	}
+
+	if err := bootcVM.WaitForSSHToBeReady(ctx); err != nil {
+		return fmt.Errorf("WaitSshReady: %w", err)
+	}
+
+	s.bootcVM = bootcVM
+	s.imageId = bootcDisk.GetImageId()
+	return nil
+}
+
+// attach opens a SSH session into the VM until the build context changes, returning the changed
+// files. If the SSH session ends first, it returns a nil list of changes and the SSH error.
+// Without a VM it just waits for changes.
+func (s *devSession) attach(ctx context.Context, watcher *utils.DirWatcher) (changed []string, sshErr error, err error) {
+	sshCtx, cancelSSH := context.WithCancel(ctx)
+	defer cancelSSH()
+
+	sshDone := make(chan error, 1)
+	if s.bootcVM != nil {
+		go func() {
+			sshDone <- s.bootcVM.RunSSH(sshCtx, nil)
+		}()
+	}
+
+	select {
+	case changed = <-watcher.Changes():
+		if s.bootcVM != nil {
+			cancelSSH()
+			<-sshDone
+		}
+		return changed, nil, nil
+	case sshErr = <-sshDone:
+		return nil, sshErr, nil
+	case <-ctx.Done():
+		if s.bootcVM != nil {
+			<-sshDone
+		}
+		return nil, nil, ctx.Err()
+	}
+}
+
+// remove stops the VM and removes its disk image
+func (s *devSession) remove() {
+	if s.bootcVM == nil {
+		return
+	}
+
+	imageId := s.imageId
+	s.release()
+
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    imageId,
+		User:       s.user,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Exclusive,
+	})
+	if err != nil {
+		logrus.Warningf("unable to remove previous VM %s: %v", imageId[:12], err)
+		return
+	}
+
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", imageId, err)
+		}
+	}()
+
+	if err := forceKillVM(bootcVM); err != nil {
+		logrus.Warningf("unable to remove previous VM %s: %v", imageId[:12], err)
+	}
+}
+
+// release closes the connection to the VM, keeping it running
+func (s *devSession) release() {
+	if s.bootcVM == nil {
+		return
+	}
+
+	s.bootcVM.CloseConnection()
+	if err := s.bootcVM.Unlock(); err != nil {
+		logrus.Warningf("unable to unlock VM %s: %v", s.imageId, err)
+	}
+	s.bootcVM = nil
+	s.imageId = ""
+}
+
+// describeChanges summarizes the files that triggered a rebuild
+func describeChanges(changed []string) string {
+	listed := changed
+	if len(listed) > devMaxListedChanges {
+		listed = listed[:devMaxListedChanges]
+	}
+
+	summary := strings.Join(listed, ", ")
+	if len(changed) > len(listed) {
+		summary += fmt.Sprintf(" and %d more", len(changed)-len(listed))
+	}
+
+	if len(changed) == 1 {
+		return "changed: " + summary
+	}
+	return fmt.Sprintf("%d files changed: %s", len(changed), summary)
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/events"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/containers/common/pkg/filters"
+	"github.com/containers/common/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+var (
+	eventsCmd = &cobra.Command{
+		Use:   "events",
+		Short: "Show the VM events",
+		Long:  "Show the lifecycle events of the VMs, and the podman-bootc events",
+		Args:  cobra.NoArgs,
+		RunE:  doEvents,
+	}
+
+	eventsFormat  string
+	eventsFilters []string
+	eventsSince   string
+	eventsStream  bool
+)
+
+// eventFilters are the filters of the events command, an event must match one value
+// of each key
+type eventFilters struct {
+	ids      []string
+	statuses []string
+}
+
+func init() {
+	RootCmd.AddCommand(eventsCmd)
+	eventsCmd.Flags().StringVar(&eventsFormat, "format", "", "Print the events in the given format, only json is supported")
+	eventsCmd.Flags().StringArrayVar(&eventsFilters, "filter", nil, "Only show the events of a VM (id=<id>) or of a status (event=<status>)")
+	eventsCmd.Flags().StringVar(&eventsSince, "since", "", "Show the recorded events since a timestamp or duration")
+	eventsCmd.Flags().BoolVar(&eventsStream, "stream", true, "Stream the new events, set to false to exit after the recorded events")
+}
+
+func doEvents(flags *cobra.Command, _ []string) error {
+	if eventsFormat != "" && !report.IsJSON(eventsFormat) {
+		return fmt.Errorf("unsupported format %q, only json is supported", eventsFormat)
+	}
+
+	filter, err := parseEventFilters(eventsFilters)
+	if err != nil {
+		return err
+	}
+
+	var since time.Time
+	if eventsSince != "" {
+		since, err = filters.ComputeUntilTimestamp([]string{eventsSince})
+		if err != nil {
+			return fmt.Errorf("invalid since %q: %w", eventsSince, err)
+		}
+	}
+
+	if !eventsStream && since.IsZero() {
+		return fmt.Errorf("--stream=false requires --since")
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(flags.Context())
+	defer cancel()
+
+	eventCh := make(chan events.Event)
+	errCh := make(chan error, 2)
+	send := func(event events.Event) {
+		select {
+		case eventCh <- event:
+		case <-ctx.Done():
+		}
+	}
+
+	// the event log records the podman-bootc events, and the lifecycle events podman-bootc
+	// drives or finds out about. When streaming, the new ones are reported live too.
+	started := time.Now()
+	dedup := newLifecycleDedup()
+	dedupEvents := eventsStream && vm.LifecycleReportedLive
+	sendRecorded := func(event events.Event) {
+		if dedupEvents && events.IsLifecycle(event.Status) && !event.Time.Before(started) && !dedup.show(event, false) {
+			return
+		}
+		send(event)
+	}
+	sendLive := func(event events.Event) {
+		if dedupEvents && !dedup.show(event, true) {
+			return
+		}
+		send(event)
+	}
+
+	logDone := make(chan struct{})
+	go func() {
+		defer close(logDone)
+		errCh <- events.Follow(ctx, usr, since, eventsStream, sendRecorded)
+	}()
+	if eventsStream {
+		go func() {
+			errCh <- vm.WatchLifecycle(ctx, config.LibvirtUri, sendLive)
+		}()
+	}
+
+	for {
+		select {
+		case event := <-eventCh:
+			if !filter.matches(event) {
+				continue
+			}
+			if err := printEvent(event); err != nil {
+				return err
+			}
+		case err := <-errCh:
+			if err != nil {
+				return err
+			}
+		case <-logDone:
+			if !eventsStream {
+				return nil
+			}
+			logDone = nil
+		}
+	}
+}
+
+// lifecycleDedup matches the lifecycle events reported live with the same ones recorded
+// in the event log, so each one is shown once, from the source reporting it first
+type lifecycleDedup struct {
+	mu sync.Mutex
+	// pending counts the events shown from the live source and not recorded yet when
+	// positive, the ones recorded and not reported live yet when negative
+	pending map[lifecycleKey]int
+}
+
+type lifecycleKey struct {
+	id     string
+	status string
+	detail string
+}
+
+func newLifecycleDedup() *lifecycleDedup {
+	return &lifecycleDedup{pending: map[lifecycleKey]int{}}
+}
+
+// show reports whether the event, live or recorded, must be shown
+func (d *lifecycleDedup) show(event events.Event, live bool) bool {
+	key := lifecycleKey{event.Id, event.Status, event.Detail}
+	delta := 1
+	if !live {
+		delta = -1
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := d.pending[key]
+	d.pending[key] = n + delta
+	// the other source already showed it
+	return n*delta >= 0
+}
+
+func parseEventFilters(filterFlags []string) (filter eventFilters, err error) {
+	for _, f := range filterFlags {
+		key, value, ok := strings.Cut(f, "=")
+		if !ok || value == "" {
+			return filter, fmt.Errorf("invalid filter %q, only id=<id> and event=<status> are supported", f)
+		}
+
+		switch key {
+		case "id":
+			filter.ids = append(filter.ids, value)
+		case "event":
+			filter.statuses = append(filter.statuses, value)
+		default:
+			return filter, fmt.Errorf("invalid filter %q, only id=<id> and event=<status> are supported", f)
+		}
+	}
+	return
+}
+
+// matches reports whether the event passes the filters, a VM ID filter matches the
+// IDs starting with it
+func (f eventFilters) matches(event events.Event) bool {
+	if len(f.ids) > 0 {
+		matched := false
+		for _, id := range f.ids {
+			if len(id) > len(event.Id) {
+				id = id[:len(event.Id)]
+			}
+			if strings.HasPrefix(event.Id, id) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.statuses) > 0 {
+		for _, status := range f.statuses {
+			if event.Status == status {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// printEvent prints an event on its own line, as a JSON object with --format json
+func printEvent(event events.Event) error {
+	if report.IsJSON(eventsFormat) {
+		out, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+
+	line := fmt.Sprintf("%s %s %s", event.Time.Local().Format(time.RFC3339), event.Id, event.Status)
+	if event.Detail != "" {
+		line += " (" + event.Detail + ")"
+	}
+	fmt.Println(line)
+	return nil
+}
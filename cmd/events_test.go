@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"github.com/containers/podman-bootc/pkg/events"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("lifecycleDedup", func() {
+	const live, recorded = true, false
+
+	It("should show the events once, from the first source", func() {
+		dedup := newLifecycleDedup()
+		start := events.New("3a7f2ce9b1d0", events.Start, "")
+		stop := events.New("3a7f2ce9b1d0", events.Stop, "destroyed")
+
+		Expect(dedup.show(start, live)).To(BeTrue())
+		Expect(dedup.show(stop, recorded)).To(BeTrue())
+		Expect(dedup.show(start, recorded)).To(BeFalse())
+		Expect(dedup.show(stop, live)).To(BeFalse())
+	})
+
+	It("should count the repeated events", func() {
+		dedup := newLifecycleDedup()
+		crash := events.New("3a7f2ce9b1d0", events.Crash, "")
+
+		Expect(dedup.show(crash, live)).To(BeTrue())
+		Expect(dedup.show(crash, live)).To(BeTrue())
+		Expect(dedup.show(crash, recorded)).To(BeFalse())
+		Expect(dedup.show(crash, recorded)).To(BeFalse())
+		// a crash only recorded, e.g. once the VM is seen stopped
+		Expect(dedup.show(crash, recorded)).To(BeTrue())
+		Expect(dedup.show(crash, live)).To(BeFalse())
+	})
+
+	It("should tell apart the VMs and the details", func() {
+		dedup := newLifecycleDedup()
+
+		Expect(dedup.show(events.New("3a7f2ce9b1d0", events.Stop, "shutdown"), live)).To(BeTrue())
+		Expect(dedup.show(events.New("3a7f2ce9b1d0", events.Stop, "saved"), recorded)).To(BeTrue())
+		Expect(dedup.show(events.New("8c1e5f0a2b4d", events.Stop, "shutdown"), recorded)).To(BeTrue())
+	})
+})
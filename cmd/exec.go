@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	execCmd = &cobra.Command{
+		Use:   "exec <ID> <command> [<arg>...]",
+		Short: "Run a command in a running VM",
+		Long:  "Run a command in a running VM, over SSH or with --agent through the qemu guest agent",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  doExec,
+	}
+
+	execAgent bool
+)
+
+func init() {
+	RootCmd.AddCommand(execCmd)
+	// the flags after the command are the command ones
+	execCmd.Flags().SetInterspersed(false)
+	execCmd.Flags().BoolVar(&execAgent, "agent", false, "Run the command through the qemu guest agent instead of SSH, its output is printed once it exits")
+}
+
+func doExec(flags *cobra.Command, args []string) error {
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	if execAgent {
+		ExitCode, err = bootcVM.AgentExec(flags.Context(), args[1:], os.Stdout, os.Stderr)
+		return err
+	}
+
+	ExitCode, err = utils.WithExitCode(bootcVM.RunSSH(flags.Context(), args[1:]))
+	return err
+}
@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var generateCmd = &cobra.Command{
+	Use:   "generate",
+	Short: "Generate files to manage bootc VMs",
+	Long:  "Generate files to manage bootc VMs",
+	Args:  cobra.NoArgs,
+}
+
+func init() {
+	RootCmd.AddCommand(generateCmd)
+}
@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/adrg/xdg"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// startTimeoutMargin is added to the readiness timeout for the time the VM takes to be defined
+const startTimeoutMargin = 30 * time.Second
+
+const systemdUnitTemplate = `# {{.Name}}
+# autogenerated by podman-bootc
+
+[Unit]
+Description=podman-bootc VM {{.Id}}{{if .RepoTag}} ({{.RepoTag}}){{end}}
+
+[Service]
+Type=notify
+NotifyAccess=main
+RemainAfterExit=yes
+ExecStart={{.ExecStart}}
+ExecStop={{.ExecStop}}
+TimeoutStartSec={{.TimeoutStart}}
+TimeoutStopSec={{.TimeoutStop}}
+
+[Install]
+WantedBy=default.target
+`
+
+var (
+	generateSystemdCmd = &cobra.Command{
+		Use:   "systemd ID",
+		Short: "Generate a systemd user unit running a VM",
+		Long:  "Generate a systemd user unit starting a VM in the background, ready once its SSH server is",
+		Args:  cobra.ExactArgs(1),
+		RunE:  doGenerateSystemd,
+	}
+
+	generateInstall     bool
+	generateWaitFor     []string
+	generateWaitTimeout time.Duration
+	generateStopTimeout time.Duration
+)
+
+func init() {
+	generateCmd.AddCommand(generateSystemdCmd)
+	generateSystemdCmd.Flags().BoolVar(&generateInstall, "install", false, "Install the unit in the systemd user units directory instead of printing it")
+	generateSystemdCmd.Flags().StringArrayVar(&generateWaitFor, "wait-for", nil, "Readiness probe of the service: ssh, vsock, systemd, unit=<name>, port=<n> or cmd=<script>, can be specified multiple times (default: ssh, vsock for the VMs run with --vsock)")
+	generateSystemdCmd.Flags().DurationVar(&generateWaitTimeout, "wait-timeout", 0, "How long to wait for the VM to be ready, e.g. 5m (default: 1m, 10m for emulated VMs)")
+	generateSystemdCmd.Flags().DurationVar(&generateStopTimeout, "stop-timeout", 30*time.Second, "How long systemd waits for the VM to stop")
+}
+
+func doGenerateSystemd(_ *cobra.Command, args []string) error {
+	if runtime.GOOS != "linux" {
+		return errors.New("systemd units are only supported on Linux")
+	}
+
+	probes, err := parseReadinessProbes(generateWaitFor)
+	if err != nil {
+		return err
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	cfg, cacheDir, err := loadVMConfig(usr, id)
+	if err != nil {
+		return err
+	}
+	longId := filepath.Base(cacheDir)
+
+	execPath, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("getting executable path: %w", err)
+	}
+	execPath, err = filepath.EvalSymlinks(execPath)
+	if err != nil {
+		return fmt.Errorf("following executable symlink: %w", err)
+	}
+
+	timeout := generateWaitTimeout
+	if timeout == 0 {
+		timeout = vm.DefaultReadyTimeout(cfg.Arch)
+	}
+
+	start := []string{execPath, "start", "--wait-timeout", timeout.String()}
+	for _, probe := range probes {
+		start = append(start, "--wait-for", probe.String())
+	}
+	start = append(start, longId)
+
+	unit := struct {
+		Name         string
+		Id           string
+		RepoTag      string
+		ExecStart    string
+		ExecStop     string
+		TimeoutStart int
+		TimeoutStop  int
+	}{
+		Name:         config.ProjectName + "-" + cfg.Id + ".service",
+		Id:           cfg.Id,
+		RepoTag:      cfg.RepoTag,
+		ExecStart:    systemdCommandLine(start),
+		ExecStop:     systemdCommandLine([]string{execPath, "stop", longId}),
+		TimeoutStart: int((timeout + startTimeoutMargin).Seconds()),
+		TimeoutStop:  int(generateStopTimeout.Seconds()),
+	}
+
+	tmpl, err := template.New("systemd-unit").Parse(systemdUnitTemplate)
+	if err != nil {
+		return err
+	}
+
+	var content bytes.Buffer
+	if err := tmpl.Execute(&content, unit); err != nil {
+		return err
+	}
+
+	if !generateInstall {
+		fmt.Print(content.String())
+		return nil
+	}
+
+	unitDir := filepath.Join(xdg.ConfigHome, "systemd", "user")
+	if err := os.MkdirAll(unitDir, 0755); err != nil {
+		return err
+	}
+
+	unitPath := filepath.Join(unitDir, unit.Name)
+	if err := os.WriteFile(unitPath, content.Bytes(), 0644); err != nil {
+		return fmt.Errorf("unable to install the unit: %w", err)
+	}
+
+	reload := exec.Command("systemctl", "--user", "daemon-reload")
+	if out, err := reload.CombinedOutput(); err != nil {
+		logrus.Warningf("unable to reload the systemd user units: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+
+	fmt.Printf("Installed %s, start it with: systemctl --user enable --now %s\n", unitPath, unit.Name)
+	return nil
+}
+
+// loadVMConfig returns the config and the cache dir of a VM, without keeping it locked
+func loadVMConfig(usr user.User, id string) (*vm.BootcVMConfig, string, error) {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		LibvirtUri: config.LibvirtUri,
+		User:       usr,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	cfg, err := bootcVM.GetConfig()
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to get the VM config: %w", err)
+	}
+	return cfg, bootcVM.CacheDir(), nil
+}
+
+// systemdCommandLine quotes the arguments of a command line for a systemd unit
+func systemdCommandLine(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		// systemd expands the specifiers and the environment variables
+		arg = strings.ReplaceAll(arg, "%", "%%")
+		arg = strings.ReplaceAll(arg, "$", "$$")
+		if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\;") {
+			quoted = append(quoted, arg)
+			continue
+		}
+
+		arg = strings.ReplaceAll(arg, `\`, `\\`)
+		arg = strings.ReplaceAll(arg, `"`, `\"`)
+		arg = strings.ReplaceAll(arg, "\n", `\n`)
+		quoted = append(quoted, `"`+arg+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
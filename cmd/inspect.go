@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/containers/podman-bootc/pkg/bootc"
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var inspectCmd = &cobra.Command{
+	Use:   "inspect <ID> [<ID>...]",
+	Short: "Display detailed information on bootc VMs",
+	Long:  "Display detailed information on bootc VMs",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  doInspect,
+}
+
+func init() {
+	RootCmd.AddCommand(inspectCmd)
+}
+
+// inspectReport is the detailed information on a VM
+type inspectReport struct {
+	vm.BootcVMConfig
+	ImageId  string
+	CacheDir string
+	// DiskImage describes how the disk image was installed
+	DiskImage *bootc.DiskMeta `json:"DiskImage"`
+	// SecureBoot reports whether Secure Boot is active in the guest, only known while it runs
+	SecureBoot *bool `json:"SecureBoot,omitempty"`
+	// Guest is reported by the guest agent of a running VM
+	Guest *vm.GuestInfo `json:"Guest,omitempty"`
+}
+
+func doInspect(_ *cobra.Command, args []string) error {
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	reports := make([]inspectReport, 0, len(args))
+	for _, id := range args {
+		report, err := inspectVM(usr, id)
+		if err != nil {
+			return fmt.Errorf("unable to inspect VM %s: %w", id, err)
+		}
+		reports = append(reports, *report)
+	}
+
+	return printJSON(reports)
+}
+
+func inspectVM(usr user.User, id string) (*inspectReport, error) {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	cfg, err := bootcVM.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &inspectReport{
+		BootcVMConfig: *cfg,
+		ImageId:       filepath.Base(bootcVM.CacheDir()),
+		CacheDir:      bootcVM.CacheDir(),
+	}
+
+	report.DiskImage, err = bootc.LoadDiskMeta(filepath.Join(bootcVM.CacheDir(), config.DiskImage))
+	if err != nil {
+		logrus.Warningf("unable to read the disk image metadata of %s: %v", id, err)
+	}
+
+	if cfg.State == vm.StateRunning {
+		secureBoot, err := bootcVM.SecureBootActive()
+		if err != nil {
+			logrus.Warningf("unable to get the Secure Boot state of %s: %v", id, err)
+		} else {
+			report.SecureBoot = &secureBoot
+		}
+
+		report.Guest, err = bootcVM.GuestInfo()
+		if err != nil {
+			logrus.Debugf("unable to get the guest information of %s: %v", id, err)
+		}
+	}
+
+	return report, nil
+}
@@ -27,8 +27,9 @@ func init() {
 
 func doList(_ *cobra.Command, _ []string) error {
 	hdrs := report.Headers(vm.BootcVMConfig{}, map[string]string{
-		"RepoTag":  "Repo",
-		"DiskSize": "Size",
+		"RepoTag":   "Repo",
+		"DiskSize":  "Size",
+		"DiskUsage": "Used",
 	})
 
 	rpt := report.New(os.Stdout, "list")
@@ -36,7 +37,7 @@ func doList(_ *cobra.Command, _ []string) error {
 
 	rpt, err := rpt.Parse(
 		report.OriginPodman,
-		"{{range . }}{{.Id}}\t{{.RepoTag}}\t{{.DiskSize}}\t{{.Created}}\t{{.Running}}\t{{.SshPort}}\n{{end -}}")
+		"{{range . }}{{.Id}}\t{{.RepoTag}}\t{{.DiskSize}}\t{{.DiskUsage}}\t{{.Created}}\t{{.State}}\t{{.SshPort}}\n{{end -}}")
 
 	if err != nil {
 		return err
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause ID",
+	Short: "Pause a running VM",
+	Long:  "Pause a running VM, it keeps its memory but doesn't use any CPU",
+	Args:  cobra.ExactArgs(1),
+	RunE:  doPause,
+}
+
+func init() {
+	RootCmd.AddCommand(pauseCmd)
+}
+
+func doPause(_ *cobra.Command, args []string) (err error) {
+	user, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		LibvirtUri: config.LibvirtUri,
+		User:       user,
+		Locking:    utils.Exclusive,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	return bootcVM.Pause()
+}
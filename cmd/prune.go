@@ -0,0 +1,339 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/containers/common/pkg/filters"
+	"github.com/containers/podman/v5/pkg/bindings/images"
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove unused bootc VMs and stale files",
+		Long:  "Remove unused bootc VMs and stale files",
+		Args:  cobra.NoArgs,
+		RunE:  doPrune,
+	}
+
+	pruneDryRun  bool
+	pruneAllVMs  bool
+	pruneFilters []string
+)
+
+func init() {
+	RootCmd.AddCommand(pruneCmd)
+	pruneCmd.Flags().BoolVar(&pruneDryRun, "dry-run", false, "Only print what would be removed")
+	pruneCmd.Flags().BoolVarP(&pruneAllVMs, "all", "a", false, "Remove all non-running VMs, not only the ones whose image was removed")
+	pruneCmd.Flags().StringArrayVar(&pruneFilters, "filter", nil, "Only remove what is older than a timestamp or duration (until=<timestamp>)")
+}
+
+// pruner removes, or only reports in dry run mode, what isn't used anymore
+type pruner struct {
+	dryRun bool
+	// allVMs removes all the non-running VMs, not only the ones whose image was removed
+	allVMs    bool
+	until     time.Time
+	reclaimed int64
+	// short IDs of the removed VMs
+	removed map[string]bool
+}
+
+func doPrune(_ *cobra.Command, _ []string) error {
+	until, err := parsePruneFilters(pruneFilters)
+	if err != nil {
+		return err
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	p := &pruner{
+		dryRun:  pruneDryRun,
+		allVMs:  pruneAllVMs,
+		until:   until,
+		removed: map[string]bool{},
+	}
+
+	if err := p.pruneVMs(usr, storeImageIds()); err != nil {
+		return err
+	}
+
+	cached, err := p.cachedIds(usr)
+	if err != nil {
+		return err
+	}
+
+	p.pruneDomains(cached)
+
+	if err := p.pruneRunDir(usr, cached); err != nil {
+		return err
+	}
+
+	if p.dryRun {
+		fmt.Printf("Total reclaimable space: %s\n", units.HumanSize(float64(p.reclaimed)))
+	} else {
+		fmt.Printf("Total reclaimed space: %s\n", units.HumanSize(float64(p.reclaimed)))
+	}
+	return nil
+}
+
+func parsePruneFilters(pruneFilters []string) (until time.Time, err error) {
+	for _, filter := range pruneFilters {
+		key, value, ok := strings.Cut(filter, "=")
+		if !ok || key != "until" {
+			return until, fmt.Errorf("invalid filter %q, only until=<timestamp> is supported", filter)
+		}
+
+		until, err = filters.ComputeUntilTimestamp([]string{value})
+		if err != nil {
+			return until, fmt.Errorf("invalid filter %q: %w", filter, err)
+		}
+	}
+
+	return
+}
+
+// storeImageIds returns the IDs of the images in the podman machine, or nil if
+// they can't be listed, in which case no VM is considered orphaned
+func storeImageIds() map[string]bool {
+	machine, err := utils.GetMachineContext()
+	if err != nil {
+		logrus.Warningf("unable to connect to the podman machine, VMs of removed images are not pruned: %v", err)
+		return nil
+	}
+
+	imageList, err := images.List(machine.Ctx, new(images.ListOptions).WithAll(true))
+	if err != nil {
+		logrus.Warningf("unable to list images, VMs of removed images are not pruned: %v", err)
+		return nil
+	}
+
+	ids := make(map[string]bool, len(imageList))
+	for _, image := range imageList {
+		ids[image.ID] = true
+	}
+	return ids
+}
+
+// pruneVMs removes the VMs whose image is gone, or all the non-running ones with
+// --all, and the leftovers of interrupted installations and previous runs
+func (p *pruner) pruneVMs(usr user.User, imageIds map[string]bool) error {
+	files, err := os.ReadDir(usr.CacheDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() || len(f.Name()) != 64 {
+			continue
+		}
+
+		if err := p.pruneVM(usr, f.Name(), imageIds); err != nil {
+			logrus.Errorf("unable to prune VM %s: %v", f.Name()[:12], err)
+		}
+	}
+
+	return nil
+}
+
+func (p *pruner) pruneVM(usr user.User, id string, imageIds map[string]bool) error {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Exclusive,
+	})
+	if err != nil {
+		if errors.Is(err, vm.ErrVMInUse) {
+			logrus.Infof("skipping VM %s, it is in use", id[:12])
+			return nil
+		}
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	// a saved VM still uses its files when it is restored
+	state, err := bootcVM.State()
+	if err != nil {
+		return fmt.Errorf("unable to check if VM is running: %w", err)
+	}
+	if state != vm.StateStopped {
+		return nil
+	}
+
+	cacheDir := bootcVM.CacheDir()
+	reason := ""
+	info, err := os.Stat(filepath.Join(cacheDir, config.DiskImage))
+	if errors.Is(err, os.ErrNotExist) {
+		reason = "incomplete installation"
+		info, err = os.Stat(cacheDir)
+	} else if imageIds != nil && !imageIds[id] {
+		reason = "image removed from the podman machine"
+	} else if p.allVMs {
+		reason = "not running"
+	}
+	if err != nil {
+		return err
+	}
+
+	if reason != "" && p.matches(info.ModTime()) {
+		size, err := utils.AllocatedSize(cacheDir)
+		if err != nil {
+			logrus.Warningf("unable to get the size of %s: %v", cacheDir, err)
+		}
+
+		if p.remove(fmt.Sprintf("VM %s (%s)", id[:12], reason), size, func() error {
+			return forceKillVM(bootcVM)
+		}) {
+			p.removed[id[:12]] = true
+		}
+		return nil
+	}
+
+	tempDisks, err := filepath.Glob(filepath.Join(cacheDir, config.TempDiskPrefix+"*"))
+	if err != nil {
+		return err
+	}
+	for _, tempDisk := range tempDisks {
+		p.pruneFile(tempDisk, "temporary disk")
+	}
+
+	// it is created again on each run
+	p.pruneFile(filepath.Join(cacheDir, config.CiDataIso), "cloud-init ISO")
+	return nil
+}
+
+// cachedIds returns the short IDs of the VMs still in the cache
+func (p *pruner) cachedIds(usr user.User) (map[string]bool, error) {
+	ids := map[string]bool{}
+	files, err := os.ReadDir(usr.CacheDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ids, nil
+		}
+		return nil, err
+	}
+
+	for _, f := range files {
+		if f.IsDir() && len(f.Name()) == 64 && !p.removed[f.Name()[:12]] {
+			ids[f.Name()[:12]] = true
+		}
+	}
+	return ids, nil
+}
+
+// pruneDomains removes the libvirt domains left behind without a VM cache dir
+func (p *pruner) pruneDomains(cached map[string]bool) {
+	ids, err := vm.ListDomainIDs(config.LibvirtUri)
+	if err != nil {
+		logrus.Warningf("unable to list libvirt domains, they are not pruned: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		if cached[id] || p.removed[id] {
+			continue
+		}
+
+		p.remove(fmt.Sprintf("libvirt domain podman-bootc-%s (no VM cache directory)", id), 0, func() error {
+			return vm.RemoveDomain(config.LibvirtUri, id)
+		})
+	}
+}
+
+// pruneRunDir removes the run directories of the VMs that are gone. The lock files are kept,
+// a process waiting for one would lock the removed file while the next one locks a new file
+// at the same path.
+func (p *pruner) pruneRunDir(usr user.User, cached map[string]bool) error {
+	files, err := os.ReadDir(usr.RunDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, f := range files {
+		path := filepath.Join(usr.RunDir(), f.Name())
+
+		// run directories of the macOS VM monitor, named after the short ID
+		if f.IsDir() && len(f.Name()) == 12 && !cached[f.Name()] {
+			p.pruneFile(path, "stale run directory")
+		}
+	}
+
+	return nil
+}
+
+// pruneFile removes a file or directory tree, if it matches the filters
+func (p *pruner) pruneFile(path string, what string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logrus.Warningf("unable to check %s: %v", path, err)
+		}
+		return
+	}
+
+	if !p.matches(info.ModTime()) {
+		return
+	}
+
+	size, err := utils.AllocatedSize(path)
+	if err != nil {
+		logrus.Warningf("unable to get the size of %s: %v", path, err)
+	}
+
+	p.remove(fmt.Sprintf("%s %s", what, path), size, func() error {
+		return os.RemoveAll(path)
+	})
+}
+
+// matches reports whether something last modified at modTime passes the until filter
+func (p *pruner) matches(modTime time.Time) bool {
+	return p.until.IsZero() || modTime.Before(p.until)
+}
+
+// remove calls removeFunc, unless in dry run mode, and reports what was removed
+func (p *pruner) remove(what string, size int64, removeFunc func() error) bool {
+	if p.dryRun {
+		fmt.Printf("Would remove %s\n", what)
+		p.reclaimed += size
+		return true
+	}
+
+	if err := removeFunc(); err != nil {
+		logrus.Errorf("unable to remove %s: %v", what, err)
+		return false
+	}
+
+	fmt.Printf("Removed %s\n", what)
+	p.reclaimed += size
+	return true
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/containers/podman-bootc/pkg/utils"
+
+	imageTypes "github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pullCmd = &cobra.Command{
+		Use:   "pull <image>",
+		Short: "Pull a bootc container image into the podman machine",
+		Long:  "Pull a bootc container image into the podman machine",
+		Args:  cobra.ExactArgs(1),
+		RunE:  doPull,
+	}
+
+	pullCmdFlags = pullFlags{}
+)
+
+// pullFlags holds the values of the flags controlling how an image is pulled
+type pullFlags struct {
+	options   utils.PullOptions
+	tlsVerify bool
+}
+
+func init() {
+	RootCmd.AddCommand(pullCmd)
+	pullCmdFlags.addTo(pullCmd, "always")
+	pullCmd.Flags().StringVar(&pullCmdFlags.options.Arch, "arch", "", "Pull the image variant of this architecture (x86_64, aarch64, s390x, ppc64le) (default: host architecture)")
+}
+
+// addTo adds the pull flags to cmd
+func (f *pullFlags) addTo(cmd *cobra.Command, defaultPolicy string) {
+	cmd.Flags().StringVar(&f.options.Policy, "pull", defaultPolicy, "Pull image policy (always, missing, never, newer)")
+	cmd.Flags().StringVar(&f.options.AuthFile, "authfile", "", "Path of the registry authentication file")
+	cmd.Flags().StringVar(&f.options.Creds, "creds", "", "Use `[username[:password]]` for accessing the registry")
+	cmd.Flags().BoolVar(&f.tlsVerify, "tls-verify", true, "Require HTTPS and verify certificates when contacting registries")
+}
+
+// pullOptions returns the pull options set by the flags of cmd
+func (f *pullFlags) pullOptions(cmd *cobra.Command) utils.PullOptions {
+	options := f.options
+	if cmd.Flags().Changed("tls-verify") {
+		options.TLSVerify = imageTypes.NewOptionalBool(f.tlsVerify)
+	}
+	return options
+}
+
+func doPull(flags *cobra.Command, args []string) error {
+	machine, err := utils.GetMachineContext()
+	if err != nil {
+		println(utils.PodmanMachineErrorMessage)
+		logrus.Errorf("failed to connect to podman machine. Is podman machine running?\n%s", err)
+		return err
+	}
+
+	ctx, cancel := utils.WithCancelOf(machine.Ctx, flags.Context())
+	defer cancel()
+
+	imageData, err := utils.PullAndInspect(ctx, args[0], pullCmdFlags.pullOptions(flags))
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(imageData.ID)
+	return nil
+}
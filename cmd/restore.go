@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore ID",
+	Short: "Restore a saved VM",
+	Long:  "Restore a saved VM from its memory state",
+	Args:  cobra.ExactArgs(1),
+	RunE:  doRestore,
+}
+
+func init() {
+	RootCmd.AddCommand(restoreCmd)
+}
+
+func doRestore(_ *cobra.Command, args []string) (err error) {
+	user, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		LibvirtUri: config.LibvirtUri,
+		User:       user,
+		Locking:    utils.Exclusive,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	return bootcVM.Restore()
+}
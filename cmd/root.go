@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 
 	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -45,11 +49,33 @@ func preExec(cmd *cobra.Command, args []string) error {
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
-func Execute() {
-	err := RootCmd.Execute()
+// The context is cancelled when the user interrupts podman-bootc.
+func Execute(ctx context.Context) {
+	err := RootCmd.ExecuteContext(ctx)
+	if err == nil {
+		return
+	}
+	// a command finishing before the interruption succeeded
+	if ctx.Err() != nil {
+		logrus.Warn("interrupted")
+		os.Exit(utils.InterruptedExitCode)
+	}
+	os.Exit(1)
+}
+
+// printJSON prints v as indented JSON, an empty list being printed as []
+func printJSON(v any) error {
+	out, err := json.MarshalIndent(v, "", "    ")
 	if err != nil {
-		os.Exit(1)
+		return err
 	}
+
+	if string(out) == "null" {
+		out = []byte("[]")
+	}
+
+	fmt.Println(string(out))
+	return nil
 }
 
 func init() {
@@ -1,8 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/containers/podman-bootc/pkg/bootc"
 	"github.com/containers/podman-bootc/pkg/config"
@@ -23,12 +30,26 @@ type osVmConfig struct {
 	RemoveVm        bool // Kill the running VM when it exits
 	RemoveDiskImage bool // After exit of the VM, remove the disk image
 	Quiet           bool
+	LockTimeout     time.Duration
+	Firmware        string
+	EnrollKeysDir   string
+	Tpm             string
+	Restart         string
+	WaitFor         []string
+	WaitTimeout     time.Duration
+	Vsock           bool
+}
+
+type buildConfig struct {
+	Build         bool
+	ContainerFile string
+	Tag           string
 }
 
 var (
 	// listCmd represents the hello command
 	runCmd = &cobra.Command{
-		Use:          "run",
+		Use:          "run <image> | <id> | --build <context>",
 		Short:        "Run a bootc container as a VM",
 		Long:         "Run a bootc container as a VM",
 		Args:         cobra.MinimumNArgs(1),
@@ -38,6 +59,9 @@ var (
 
 	vmConfig                = osVmConfig{}
 	diskImageConfigInstance = bootc.DiskImageConfig{}
+	runPullFlags            = pullFlags{}
+	runBuildConfig          = buildConfig{}
+	runVerifyOptions        = utils.VerifyOptions{}
 )
 
 func init() {
@@ -52,9 +76,32 @@ func init() {
 	runCmd.Flags().BoolVar(&vmConfig.Quiet, "quiet", false, "Suppress output from bootc disk creation and VM boot console")
 	runCmd.Flags().StringVar(&diskImageConfigInstance.RootSizeMax, "root-size-max", "", "Maximum size of root filesystem in bytes; optionally accepts M, G, T suffixes")
 	runCmd.Flags().StringVar(&diskImageConfigInstance.DiskSize, "disk-size", "", "Allocate a disk image of this size in bytes; optionally accepts M, G, T suffixes")
+	runPullFlags.addTo(runCmd, "missing")
+	runCmd.Flags().StringVar(&runPullFlags.options.Arch, "arch", "", "Run a VM of this architecture (x86_64, aarch64, s390x, ppc64le), emulated if it differs from the host (default: host architecture)")
+	runCmd.Flags().BoolVar(&runBuildConfig.Build, "build", false, "Build the image from the given build context directory before running it")
+	runCmd.Flags().StringVarP(&runBuildConfig.ContainerFile, "file", "f", "", "Containerfile used by --build (default: Containerfile or Dockerfile in the build context)")
+	runCmd.Flags().StringVarP(&runBuildConfig.Tag, "tag", "t", "", "Name of the image built by --build (default: localhost/<build context directory name>:latest)")
+	runCmd.Flags().DurationVar(&vmConfig.LockTimeout, "lock-timeout", 0, "How long to wait for another podman-bootc process using the same image, e.g. 5m (default: fail immediately)")
+	runCmd.Flags().StringArrayVar(&diskImageConfigInstance.KernelArgs, "karg", nil, "Add a kernel argument to the installed system, can be specified multiple times")
+	runCmd.Flags().StringVar(&diskImageConfigInstance.TargetImgRef, "target-imgref", "", "Container image reference tracked by the installed system for updates (e.g. quay.io/example/os:latest)")
+	runCmd.Flags().StringVar(&diskImageConfigInstance.Stateroot, "stateroot", "", "Name of the ostree stateroot used by the installed system")
+	runCmd.Flags().BoolVar(&diskImageConfigInstance.TargetNoSignatureVerification, "target-no-signature-verification", false, "Disable signature verification when the installed system fetches updates from --target-imgref")
+	runCmd.Flags().BoolVar(&runVerifyOptions.Verify, "verify", false, "Verify the image signatures with the default signature policy before installing it")
+	runCmd.Flags().StringVar(&runVerifyOptions.PolicyPath, "signature-policy", "", "Verify the image signatures with this signature policy file before installing it, implies --verify")
+	runCmd.Flags().StringVar(&runVerifyOptions.RegistriesDirPath, "registries-dir", "", "Read the registries configuration of the image signatures from this directory when verifying them")
+	runCmd.Flags().StringVar(&vmConfig.Firmware, "firmware", "", "Firmware of the VM: bios, efi or efi-secboot (default: efi on x86_64 and aarch64)")
+	runCmd.Flags().StringVar(&vmConfig.Tpm, "tpm", "", "TPM version of the VM: none, 1.2 or 2.0 (default: 2.0 when the architecture has a TPM)")
+	runCmd.Flags().StringVar(&vmConfig.EnrollKeysDir, "enroll-keys", "", "Enroll the Secure Boot keys PK.crt, KEK.crt and db.crt of this directory, requires --firmware efi-secboot")
+	runCmd.Flags().StringVar(&vmConfig.Restart, "restart", "", "Restart policy of the VM: no, on-failure or always (default: no)")
+	runCmd.Flags().StringArrayVar(&vmConfig.WaitFor, "wait-for", nil, "Wait for the VM to be ready: ssh, vsock, systemd, unit=<name>, port=<n> or cmd=<script>, can be specified multiple times")
+	runCmd.Flags().DurationVar(&vmConfig.WaitTimeout, "wait-timeout", 0, "How long to wait for the VM to be ready, e.g. 5m (default: 1m, 10m for emulated VMs)")
+	runCmd.Flags().BoolVar(&vmConfig.Vsock, "vsock", false, "Run the commands over vsock instead of SSH, requires systemd 256 in the image")
 }
 
-func doRun(flags *cobra.Command, args []string) error {
+func doRun(flags *cobra.Command, args []string) (err error) {
+	// cancelled when the user interrupts podman-bootc
+	ctx := flags.Context()
+
 	//get user info who is running the podman bootc command
 	user, err := user.NewUser()
 	if err != nil {
@@ -68,10 +115,63 @@ func doRun(flags *cobra.Command, args []string) error {
 		return err
 	}
 
-	// create the disk image
+	// checked before the image is pulled and installed
+	if err := vm.ValidateArch(runPullFlags.options.Arch); err != nil {
+		return err
+	}
+
+	if err := vm.ValidateFirmware(vmConfig.Firmware, vmConfig.EnrollKeysDir); err != nil {
+		return err
+	}
+
+	if err := vm.ValidateTPM(vmConfig.Tpm); err != nil {
+		return err
+	}
+
+	if err := vm.ValidateRestartPolicy(vmConfig.Restart); err != nil {
+		return err
+	}
+
+	if vmConfig.RemoveVm && vmConfig.Restart != "" && vmConfig.Restart != vm.RestartNo {
+		return errors.New("--rm can't be used with --restart")
+	}
+
+	probes, err := parseReadinessProbes(vmConfig.WaitFor)
+	if err != nil {
+		return err
+	}
+
+	enrollKeysDir := vmConfig.EnrollKeysDir
+	if enrollKeysDir != "" {
+		// the keys are read when the VM is defined, not from the current directory
+		enrollKeysDir, err = filepath.Abs(enrollKeysDir)
+		if err != nil {
+			return fmt.Errorf("unable to get the Secure Boot keys directory: %w", err)
+		}
+	}
+
 	idOrName := args[0]
+	pullOptions := runPullFlags.pullOptions(flags)
+	if runBuildConfig.Build {
+		if runVerifyOptions.Enabled() {
+			return errors.New("--verify and --signature-policy can't be used with --build, the built image is not signed")
+		}
+		idOrName, err = buildImage(ctx, machine.Ctx, args[0], runBuildConfig, pullOptions, vmConfig.Quiet)
+		if err != nil {
+			return err
+		}
+		// the pull policy applied to the base images, the built image is only local
+		pullOptions.Policy = "never"
+	} else if flags.Flags().Changed("file") || flags.Flags().Changed("tag") {
+		return errors.New("--file and --tag require --build")
+	}
+
+	// create the disk image
 	bootcDisk := bootc.NewBootcDisk(idOrName, machine.Ctx, user)
-	err = bootcDisk.Install(vmConfig.Quiet, diskImageConfigInstance)
+	bootcDisk.LockTimeout = vmConfig.LockTimeout
+	bootcDisk.PullOptions = pullOptions
+	bootcDisk.VerifyOptions = runVerifyOptions
+	err = bootcDisk.Install(ctx, vmConfig.Quiet, diskImageConfigInstance)
 
 	if err != nil {
 		return fmt.Errorf("unable to install bootc image: %w", err)
@@ -85,10 +185,12 @@ func doRun(flags *cobra.Command, args []string) error {
 	}
 
 	bootcVM, err := vm.NewVM(vm.NewVMParameters{
-		ImageID:    bootcDisk.GetImageId(),
-		User:       user,
-		LibvirtUri: config.LibvirtUri,
-		Locking:    utils.Shared,
+		ImageID:     bootcDisk.GetImageId(),
+		User:        user,
+		LibvirtUri:  config.LibvirtUri,
+		Locking:     utils.Shared,
+		LockTimeout: vmConfig.LockTimeout,
+		Ctx:         ctx,
 	})
 
 	if err != nil {
@@ -108,8 +210,14 @@ func doRun(flags *cobra.Command, args []string) error {
 		return fmt.Errorf("unable to generate ssh key: %w", err)
 	}
 
+	if vm.SSHHostKeyInjected {
+		if _, err := credentials.GenerateHostKey(bootcVM.CacheDir()); err != nil {
+			return fmt.Errorf("unable to generate ssh host key: %w", err)
+		}
+	}
+
 	cmd := args[1:]
-	err = bootcVM.Run(vm.RunVMParameters{
+	err = bootcVM.Run(ctx, vm.RunVMParameters{
 		Cmd:           cmd,
 		CloudInitDir:  vmConfig.CloudInitDir,
 		CloudInitData: flags.Flags().Changed("cloudinit"),
@@ -118,17 +226,39 @@ func doRun(flags *cobra.Command, args []string) error {
 		SSHPort:       sshPort,
 		SSHIdentity:   sSHIdentityPath,
 		VMUser:        vmConfig.User,
+		Arch:          bootcDisk.GetArch(),
+		Firmware:      vmConfig.Firmware,
+		EnrollKeysDir: enrollKeysDir,
+		Tpm:           vmConfig.Tpm,
+		Restart:       vmConfig.Restart,
+		Vsock:         vmConfig.Vsock,
 	})
 
 	if err != nil {
 		return fmt.Errorf("runBootcVM: %w", err)
 	}
 
+	// Don't leave a half booted VM behind if the user gives up waiting for it
+	defer func() {
+		if ctx.Err() == nil {
+			return
+		}
+		if err := bootcVM.Delete(); err != nil {
+			logrus.Errorf("unable to remove interrupted VM: %v", err)
+		}
+	}()
+
 	// write down the config file
 	if err = bootcVM.WriteConfig(*bootcDisk); err != nil {
 		return err
 	}
 
+	if vmConfig.Background && len(probes) > 0 {
+		if err := bootcVM.WaitForReady(ctx, probes, vmConfig.WaitTimeout); err != nil {
+			return fmt.Errorf("WaitReady: %w", err)
+		}
+	}
+
 	if !vmConfig.Background {
 		if !vmConfig.Quiet {
 			go func() {
@@ -138,7 +268,7 @@ func doRun(flags *cobra.Command, args []string) error {
 				}
 			}()
 
-			err = bootcVM.WaitForSSHToBeReady()
+			err = bootcVM.WaitForReady(ctx, probes, vmConfig.WaitTimeout)
 			if err != nil {
 				return fmt.Errorf("WaitSshReady: %w", err)
 			}
@@ -152,14 +282,14 @@ func doRun(flags *cobra.Command, args []string) error {
 			// cleanly stopping the routing via a channel is not possible.
 			time.Sleep(1 * time.Second)
 		} else {
-			err = bootcVM.WaitForSSHToBeReady()
+			err = bootcVM.WaitForReady(ctx, probes, vmConfig.WaitTimeout)
 			if err != nil {
 				return fmt.Errorf("WaitSshReady: %w", err)
 			}
 		}
 
 		// ssh into the VM
-		ExitCode, err = utils.WithExitCode(bootcVM.RunSSH(cmd))
+		ExitCode, err = utils.WithExitCode(bootcVM.RunSSH(ctx, cmd))
 		if err != nil {
 			return fmt.Errorf("ssh: %w", err)
 		}
@@ -175,3 +305,77 @@ func doRun(flags *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// parseReadinessProbes parses the --wait-for probes
+func parseReadinessProbes(waitFor []string) ([]vm.ReadinessProbe, error) {
+	var probes []vm.ReadinessProbe
+	for _, w := range waitFor {
+		probe, err := vm.ParseReadinessProbe(w)
+		if err != nil {
+			return nil, err
+		}
+		probes = append(probes, probe)
+	}
+	return probes, nil
+}
+
+// buildImage builds the image from the contextDir build context, streaming the build
+// output, and returns the tag of the built image
+func buildImage(ctx context.Context, machineCtx context.Context, contextDir string, buildCfg buildConfig, pullOptions utils.PullOptions, quiet bool) (string, error) {
+	tag := buildCfg.Tag
+	if tag == "" {
+		tag = defaultBuildTag(contextDir)
+	}
+
+	containerFile := buildCfg.ContainerFile
+	if containerFile != "" && !filepath.IsAbs(containerFile) {
+		if _, err := os.Stat(containerFile); err != nil {
+			// like podman, a relative Containerfile may also be relative to the build context
+			containerFile = filepath.Join(contextDir, containerFile)
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if quiet {
+		out = io.Discard
+	}
+
+	buildCtx, cancel := utils.WithCancelOf(machineCtx, ctx)
+	defer cancel()
+
+	fmt.Printf("Building image %s from %s\n", tag, contextDir)
+	imageId, err := utils.BuildImage(buildCtx, utils.BuildOptions{
+		ContextDir:    contextDir,
+		ContainerFile: containerFile,
+		Tag:           tag,
+		Pull:          pullOptions,
+		Out:           out,
+	})
+	if err != nil {
+		return "", err
+	}
+	logrus.Debugf("built image %s as %s", imageId, tag)
+
+	return tag, nil
+}
+
+// defaultBuildTag names the built image after the build context directory
+func defaultBuildTag(contextDir string) string {
+	name := "podman-bootc-build"
+	if absDir, err := filepath.Abs(contextDir); err == nil {
+		sanitized := strings.Trim(strings.Map(func(r rune) rune {
+			switch {
+			case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+				return r
+			case r >= 'A' && r <= 'Z':
+				return unicode.ToLower(r)
+			default:
+				return '-'
+			}
+		}, filepath.Base(absDir)), ".-_")
+		if sanitized != "" {
+			name = sanitized
+		}
+	}
+	return "localhost/" + name + ":latest"
+}
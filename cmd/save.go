@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var saveCmd = &cobra.Command{
+	Use:   "save ID",
+	Short: "Save the memory state of a VM and stop it",
+	Long:  "Save the memory state of a running or paused VM to its cache directory and stop it",
+	Args:  cobra.ExactArgs(1),
+	RunE:  doSave,
+}
+
+func init() {
+	RootCmd.AddCommand(saveCmd)
+}
+
+func doSave(_ *cobra.Command, args []string) (err error) {
+	user, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		LibvirtUri: config.LibvirtUri,
+		User:       user,
+		Locking:    utils.Exclusive,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	return bootcVM.Save()
+}
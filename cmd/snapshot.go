@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage VM snapshots",
+	Long:  "Manage VM snapshots",
+	Args:  cobra.NoArgs,
+}
+
+func init() {
+	RootCmd.AddCommand(snapshotCmd)
+}
+
+// withSnapshotVM runs fn with the VM locked, the snapshots are only changed
+// under an exclusive lock
+func withSnapshotVM(id string, locking utils.AccessMode, fn func(vm.BootcVM) error) error {
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    locking,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	return fn(bootcVM)
+}
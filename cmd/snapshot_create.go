@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotCreateCmd = &cobra.Command{
+		Use:   "create <ID> <name>",
+		Short: "Create a snapshot of a VM",
+		Long:  "Create a snapshot of a VM, with its memory when it is running",
+		Args:  cobra.ExactArgs(2),
+		RunE:  doSnapshotCreate,
+	}
+
+	snapshotDiskOnly bool
+)
+
+func init() {
+	snapshotCmd.AddCommand(snapshotCreateCmd)
+	snapshotCreateCmd.Flags().BoolVar(&snapshotDiskOnly, "disk-only", false, "Only save the disk of a running VM, freezing its filesystems with the guest agent")
+}
+
+func doSnapshotCreate(_ *cobra.Command, args []string) error {
+	id, name := args[0], args[1]
+	if err := vm.ValidateSnapshotName(name); err != nil {
+		return err
+	}
+
+	return withSnapshotVM(id, utils.Exclusive, func(bootcVM vm.BootcVM) error {
+		snapshot, err := bootcVM.CreateSnapshot(name, snapshotDiskOnly)
+		if err != nil {
+			return fmt.Errorf("unable to create snapshot %s of VM %s: %w", name, id, err)
+		}
+
+		fmt.Println(snapshot.Name)
+		return nil
+	})
+}
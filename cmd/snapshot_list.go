@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/containers/common/pkg/report"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+)
+
+var (
+	snapshotListCmd = &cobra.Command{
+		Use:   "list <ID>",
+		Short: "List the snapshots of a VM",
+		Long:  "List the snapshots of a VM",
+		Args:  cobra.ExactArgs(1),
+		RunE:  doSnapshotList,
+	}
+
+	snapshotListFormat string
+)
+
+func init() {
+	snapshotCmd.AddCommand(snapshotListCmd)
+	snapshotListCmd.Flags().StringVar(&snapshotListFormat, "format", "", "Print the snapshots in the given format, only json is supported")
+}
+
+// snapshotRow is a snapshot line of the snapshot list table
+type snapshotRow struct {
+	Name    string
+	Created string
+	State   string
+	Current bool
+}
+
+func doSnapshotList(_ *cobra.Command, args []string) error {
+	if snapshotListFormat != "" && !report.IsJSON(snapshotListFormat) {
+		return fmt.Errorf("unsupported format %q, only json is supported", snapshotListFormat)
+	}
+
+	id := args[0]
+	var snapshots []vm.Snapshot
+	var current string
+	err := withSnapshotVM(id, utils.Shared, func(bootcVM vm.BootcVM) (err error) {
+		snapshots, err = bootcVM.ListSnapshots()
+		if err != nil {
+			return err
+		}
+		current, err = bootcVM.CurrentSnapshot()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to list the snapshots of VM %s: %w", id, err)
+	}
+
+	if report.IsJSON(snapshotListFormat) {
+		if snapshots == nil {
+			snapshots = []vm.Snapshot{}
+		}
+		return printJSON(snapshots)
+	}
+
+	rows := make([]snapshotRow, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		rows = append(rows, snapshotRow{
+			Name:    snapshot.Name,
+			Created: units.HumanDuration(time.Since(snapshot.Created)) + " ago",
+			State:   snapshot.State,
+			Current: snapshot.Name == current,
+		})
+	}
+
+	rpt := report.New(os.Stdout, "snapshot list")
+	defer rpt.Flush()
+
+	rpt, err = rpt.Parse(
+		report.OriginPodman,
+		"{{range . }}{{.Name}}\t{{.Created}}\t{{.State}}\t{{.Current}}\n{{end -}}")
+	if err != nil {
+		return err
+	}
+
+	if err := rpt.Execute(report.Headers(snapshotRow{}, nil)); err != nil {
+		return err
+	}
+
+	return rpt.Execute(rows)
+}
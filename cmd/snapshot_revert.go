@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/spf13/cobra"
+)
+
+var snapshotRevertCmd = &cobra.Command{
+	Use:   "revert <ID> <name>",
+	Short: "Revert a VM to a snapshot",
+	Long:  "Revert a VM to a snapshot, discarding its current state",
+	Args:  cobra.ExactArgs(2),
+	RunE:  doSnapshotRevert,
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotRevertCmd)
+}
+
+func doSnapshotRevert(_ *cobra.Command, args []string) error {
+	id, name := args[0], args[1]
+
+	return withSnapshotVM(id, utils.Exclusive, func(bootcVM vm.BootcVM) error {
+		if err := bootcVM.RevertSnapshot(name); err != nil {
+			return fmt.Errorf("unable to revert VM %s to snapshot %s: %w", id, name, err)
+		}
+		return nil
+	})
+}
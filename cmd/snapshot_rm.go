@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/spf13/cobra"
+)
+
+var snapshotRmCmd = &cobra.Command{
+	Use:   "rm <ID> <name> [<name>...]",
+	Short: "Remove snapshots of a VM",
+	Long:  "Remove snapshots of a VM",
+	Args:  cobra.MinimumNArgs(2),
+	RunE:  doSnapshotRm,
+}
+
+func init() {
+	snapshotCmd.AddCommand(snapshotRmCmd)
+}
+
+func doSnapshotRm(_ *cobra.Command, args []string) error {
+	id, names := args[0], args[1:]
+
+	return withSnapshotVM(id, utils.Exclusive, func(bootcVM vm.BootcVM) error {
+		for _, name := range names {
+			if err := bootcVM.DeleteSnapshot(name); err != nil {
+				return fmt.Errorf("unable to remove snapshot %s of VM %s: %w", name, id, err)
+			}
+			fmt.Println(name)
+		}
+		return nil
+	})
+}
@@ -24,7 +24,7 @@ func init() {
 	sshCmd.Flags().StringVarP(&sshUser, "user", "u", "root", "--user <user name> (default: root)")
 }
 
-func doSsh(_ *cobra.Command, args []string) error {
+func doSsh(flags *cobra.Command, args []string) error {
 	user, err := user.NewUser()
 	if err != nil {
 		return err
@@ -61,6 +61,6 @@ func doSsh(_ *cobra.Command, args []string) error {
 		cmd = args[1:]
 	}
 
-	ExitCode, err = utils.WithExitCode(vm.RunSSH(cmd))
+	ExitCode, err = utils.WithExitCode(vm.RunSSH(flags.Context(), cmd))
 	return err
 }
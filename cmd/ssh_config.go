@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sshConfigCmd = &cobra.Command{
+		Use:   "ssh-config [ID...]",
+		Short: "Print the ssh_config stanzas of VMs",
+		Long:  "Print the ssh_config stanzas connecting to the VMs with ssh and the tools using it, all the VMs when no ID is given",
+		RunE:  doSshConfig,
+	}
+
+	sshConfigInclude bool
+)
+
+func init() {
+	RootCmd.AddCommand(sshConfigCmd)
+	sshConfigCmd.Flags().BoolVar(&sshConfigInclude, "include", false, "Write a file including the stanzas of all the VMs, kept up to date by run, start and rm, to include in the ssh configuration")
+}
+
+func doSshConfig(_ *cobra.Command, args []string) error {
+	if sshConfigInclude && len(args) > 0 {
+		return errors.New("--include accepts no VM ID, it includes all the VMs")
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	ids := args
+	if len(ids) == 0 {
+		// there are no VMs before the cache dir is created
+		files, err := os.ReadDir(usr.CacheDir())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() && len(f.Name()) == 64 {
+				ids = append(ids, f.Name())
+			}
+		}
+	}
+
+	for _, id := range ids {
+		stanza, err := vmSSHConfig(usr, id, sshConfigInclude)
+		if err != nil {
+			// all the VMs are listed, skip the broken ones as list does
+			if len(args) == 0 {
+				logrus.Warningf("skipping vm %s reason: %v", id, err)
+				continue
+			}
+			return err
+		}
+
+		if !sshConfigInclude {
+			fmt.Println(stanza)
+		}
+	}
+
+	if !sshConfigInclude {
+		return nil
+	}
+
+	includeFile, err := vm.WriteSSHConfigInclude(usr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s, add this line at the top of %s:\n", includeFile, filepath.Join(usr.SSHDir(), "config"))
+	fmt.Printf("Include %s\n", includeFile)
+	return nil
+}
+
+// vmSSHConfig returns the ssh_config stanza of a VM. With write, it updates the one included
+// by the ssh configuration, the VMs created by older versions don't have it.
+func vmSSHConfig(usr user.User, id string, write bool) (string, error) {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	if write {
+		return bootcVM.WriteSSHConfig()
+	}
+	return bootcVM.SSHConfig()
+}
@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/coreos/go-systemd/v22/daemon"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	startCmd = &cobra.Command{
+		Use:   "start [ID...]",
+		Short: "Start stopped VMs in the background",
+		Long:  "Start stopped VMs in the background, as they were last run",
+		Args:  idsOrAll(&startAll),
+		RunE:  doStart,
+	}
+
+	startAll         bool
+	startRestartable bool
+	startWaitFor     []string
+	startWaitTimeout time.Duration
+)
+
+func init() {
+	RootCmd.AddCommand(startCmd)
+	startCmd.Flags().BoolVar(&startAll, "all", false, "Start all the stopped VMs")
+	startCmd.Flags().BoolVar(&startRestartable, "restartable", false, "Only start the VMs with the always restart policy, e.g. when the host boots")
+	startCmd.Flags().StringArrayVar(&startWaitFor, "wait-for", nil, "Wait for the VMs to be ready: ssh, vsock, systemd, unit=<name>, port=<n> or cmd=<script>, can be specified multiple times")
+	startCmd.Flags().DurationVar(&startWaitTimeout, "wait-timeout", 0, "How long to wait for each VM to be ready, e.g. 5m (default: 1m, 10m for emulated VMs)")
+}
+
+// idsOrAll accepts VM IDs, or none when the all flag is set
+func idsOrAll(all *bool) cobra.PositionalArgs {
+	return func(_ *cobra.Command, args []string) error {
+		if len(args) == 0 && !*all {
+			return errors.New("requires at least 1 arg(s), or --all")
+		}
+		if len(args) != 0 && *all {
+			return fmt.Errorf("accepts 0 arg(s) with --all, received %d", len(args))
+		}
+		return nil
+	}
+}
+
+func doStart(flags *cobra.Command, args []string) error {
+	probes, err := parseReadinessProbes(startWaitFor)
+	if err != nil {
+		return err
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	ids := args
+	if startAll {
+		files, err := os.ReadDir(usr.CacheDir())
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() && len(f.Name()) == 64 {
+				ids = append(ids, f.Name())
+			}
+		}
+	}
+
+	failed := 0
+	for _, id := range ids {
+		started, err := startVM(flags.Context(), usr, id, probes)
+		if err != nil {
+			if flags.Context().Err() != nil {
+				return err
+			}
+			logrus.Errorf("unable to start VM %s: %v", id, err)
+			failed++
+			continue
+		}
+		if started {
+			fmt.Println(id)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("unable to start %d VM(s)", failed)
+	}
+
+	// tell systemd the VMs are ready when running as a Type=notify service
+	if _, err := daemon.SdNotify(false, daemon.SdNotifyReady); err != nil {
+		logrus.Warningf("unable to notify systemd: %v", err)
+	}
+	return nil
+}
+
+// startVM starts a VM and waits for it to be ready, it reports whether it was started.
+// With --all, the running VMs are skipped.
+func startVM(ctx context.Context, usr user.User, id string, probes []vm.ReadinessProbe) (bool, error) {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		LibvirtUri: config.LibvirtUri,
+		User:       usr,
+		Locking:    utils.Exclusive,
+	})
+	if err != nil {
+		if startAll && errors.Is(err, vm.ErrVMInUse) {
+			logrus.Infof("skipping VM %s, it is in use", id[:12])
+			return false, nil
+		}
+		return false, err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	cfg, err := bootcVM.GetConfig()
+	if err != nil {
+		return false, fmt.Errorf("unable to get the VM config: %w", err)
+	}
+
+	if startRestartable && cfg.Restart != vm.RestartAlways {
+		return false, nil
+	}
+
+	if startAll && cfg.State != vm.StateStopped && cfg.State != vm.StateSaved {
+		logrus.Infof("skipping VM %s, it is %s", cfg.Id, cfg.State)
+		return false, nil
+	}
+
+	if err := bootcVM.Start(ctx); err != nil {
+		return false, err
+	}
+
+	if len(probes) == 0 && startWaitTimeout == 0 {
+		return true, nil
+	}
+	return true, bootcVM.WaitForReady(ctx, probes, startWaitTimeout)
+}
@@ -0,0 +1,225 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/containers/common/pkg/report"
+	"github.com/spf13/cobra"
+)
+
+// statsSampleDelay is the delay between the first two samples, the CPU usage is
+// computed from the difference between two samples
+const statsSampleDelay = time.Second
+
+var (
+	statsCmd = &cobra.Command{
+		Use:   "stats [ID...]",
+		Short: "Display the resource usage of running VMs",
+		Long:  "Display a live stream of the CPU, memory, disk and network usage of running VMs",
+		RunE:  doStats,
+	}
+
+	statsNoStream bool
+	statsFormat   string
+	statsInterval int
+)
+
+// vmStatsReport is the resource usage of a VM, in bytes
+type vmStatsReport struct {
+	Id         string
+	CPUPercent float64
+	MemUsage   uint64
+	MemLimit   uint64
+	MemPercent float64
+	BlockRead  int64
+	BlockWrite int64
+	// NetRx and NetTx are unknown for VMs without a host side network interface
+	NetRx *int64 `json:",omitempty"`
+	NetTx *int64 `json:",omitempty"`
+}
+
+// vmStatsRow is a VM line of the stats table
+type vmStatsRow struct {
+	Id         string
+	CPUPercent string
+	MemUsage   string
+	MemPercent string
+	NetIO      string
+	BlockIO    string
+}
+
+func init() {
+	RootCmd.AddCommand(statsCmd)
+	statsCmd.Flags().BoolVar(&statsNoStream, "no-stream", false, "Display the resource usage once instead of refreshing it")
+	statsCmd.Flags().StringVar(&statsFormat, "format", "", "Print the resource usage in the given format, only json is supported")
+	statsCmd.Flags().IntVarP(&statsInterval, "interval", "i", 5, "Time in seconds between refreshes of the resource usage")
+}
+
+func doStats(flags *cobra.Command, args []string) error {
+	if statsFormat != "" && !report.IsJSON(statsFormat) {
+		return fmt.Errorf("unsupported format %q, only json is supported", statsFormat)
+	}
+	if statsInterval < 1 {
+		return fmt.Errorf("invalid interval %d, it must be at least 1 second", statsInterval)
+	}
+
+	ctx := flags.Context()
+
+	previous, err := collectStats(args)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range args {
+		if len(matchStats(previous, []string{id})) == 0 {
+			return fmt.Errorf("VM %s is not running", id)
+		}
+	}
+
+	delay := statsSampleDelay
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = time.Duration(statsInterval) * time.Second
+
+		current, err := collectStats(args)
+		if err != nil {
+			return err
+		}
+
+		reports := statsReports(previous, current)
+		previous = current
+
+		if report.IsJSON(statsFormat) {
+			err = printJSON(reports)
+		} else {
+			if !statsNoStream {
+				// clear the screen and move the cursor to its top left corner
+				fmt.Print("\033[2J\033[H")
+			}
+			err = printStatsTable(reports)
+		}
+		if err != nil {
+			return err
+		}
+
+		if statsNoStream {
+			return nil
+		}
+	}
+}
+
+// collectStats samples the resource usage of the running VMs matching the IDs, all
+// the running VMs when there are none
+func collectStats(ids []string) ([]vm.VMStats, error) {
+	stats, err := vm.CollectStats(config.LibvirtUri)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return stats, nil
+	}
+	return matchStats(stats, ids), nil
+}
+
+// matchStats returns the stats of the VMs whose ID starts with one of the IDs
+func matchStats(stats []vm.VMStats, ids []string) []vm.VMStats {
+	var matched []vm.VMStats
+	for _, s := range stats {
+		for _, id := range ids {
+			if len(id) > len(s.Id) {
+				id = id[:len(s.Id)]
+			}
+			if strings.HasPrefix(s.Id, id) {
+				matched = append(matched, s)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+func statsReports(previous, current []vm.VMStats) []vmStatsReport {
+	reports := []vmStatsReport{}
+	for _, s := range current {
+		r := vmStatsReport{
+			Id:         s.Id,
+			MemUsage:   s.MemoryUsage,
+			MemLimit:   s.MemoryLimit,
+			BlockRead:  s.BlockRead,
+			BlockWrite: s.BlockWrite,
+		}
+
+		for _, p := range previous {
+			if p.Id == s.Id {
+				r.CPUPercent = s.CPUPercent(p)
+				break
+			}
+		}
+
+		if s.MemoryLimit > 0 {
+			r.MemPercent = float64(s.MemoryUsage) / float64(s.MemoryLimit) * 100
+		}
+
+		if s.NetAvailable {
+			r.NetRx = &s.NetRx
+			r.NetTx = &s.NetTx
+		}
+
+		reports = append(reports, r)
+	}
+	return reports
+}
+
+func printStatsTable(reports []vmStatsReport) error {
+	var rows []vmStatsRow
+	for _, r := range reports {
+		netIO := "--"
+		if r.NetRx != nil && r.NetTx != nil {
+			netIO = humanSize(*r.NetRx) + " / " + humanSize(*r.NetTx)
+		}
+
+		rows = append(rows, vmStatsRow{
+			Id:         r.Id,
+			CPUPercent: fmt.Sprintf("%.2f%%", r.CPUPercent),
+			MemUsage:   humanSize(int64(r.MemUsage)) + " / " + humanSize(int64(r.MemLimit)),
+			MemPercent: fmt.Sprintf("%.2f%%", r.MemPercent),
+			NetIO:      netIO,
+			BlockIO:    humanSize(r.BlockRead) + " / " + humanSize(r.BlockWrite),
+		})
+	}
+
+	hdrs := report.Headers(vmStatsRow{}, map[string]string{
+		"CPUPercent": "CPU %",
+		"MemUsage":   "Mem usage / Limit",
+		"MemPercent": "Mem %",
+		"NetIO":      "Net IO",
+		"BlockIO":    "Block IO",
+	})
+
+	rpt := report.New(os.Stdout, "stats")
+	defer rpt.Flush()
+
+	rpt, err := rpt.Parse(
+		report.OriginPodman,
+		"{{range . }}{{.Id}}\t{{.CPUPercent}}\t{{.MemUsage}}\t{{.MemPercent}}\t{{.NetIO}}\t{{.BlockIO}}\n{{end -}}")
+	if err != nil {
+		return err
+	}
+
+	if err := rpt.Execute(hdrs); err != nil {
+		return err
+	}
+
+	return rpt.Execute(rows)
+}
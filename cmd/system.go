@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var systemCmd = &cobra.Command{
+	Use:   "system",
+	Short: "Manage podman-bootc",
+	Long:  "Manage podman-bootc",
+	Args:  cobra.NoArgs,
+}
+
+func init() {
+	RootCmd.AddCommand(systemCmd)
+}
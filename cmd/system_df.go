@@ -0,0 +1,209 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/containers/common/pkg/report"
+	"github.com/docker/go-units"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	systemDfCmd = &cobra.Command{
+		Use:   "df",
+		Short: "Show podman-bootc disk usage",
+		Long:  "Show podman-bootc disk usage",
+		Args:  cobra.NoArgs,
+		RunE:  doSystemDf,
+	}
+
+	systemDfFormat string
+)
+
+func init() {
+	systemCmd.AddCommand(systemDfCmd)
+	systemDfCmd.Flags().StringVar(&systemDfFormat, "format", "", "Print the disk usage in the given format, only json is supported")
+}
+
+// vmDiskUsage is the disk space allocated to a VM, in bytes
+type vmDiskUsage struct {
+	Id      string
+	RepoTag string `json:"Repository"`
+	Running bool
+	State   string
+	vm.DiskUsage
+}
+
+// diskUsageReport is the disk space allocated to the cache, in bytes
+type diskUsageReport struct {
+	VMs   []vmDiskUsage
+	Total int64
+	// Reclaimable is the space used by the stopped VMs
+	Reclaimable int64
+}
+
+// diskUsageRow is a VM line of the system df table
+type diskUsageRow struct {
+	Id        string
+	RepoTag   string
+	Disk      string
+	CloudInit string
+	Keys      string
+	Snapshots string
+	Total     string
+	State     string
+}
+
+func doSystemDf(_ *cobra.Command, _ []string) error {
+	if systemDfFormat != "" && !report.IsJSON(systemDfFormat) {
+		return fmt.Errorf("unsupported format %q, only json is supported", systemDfFormat)
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	usage, err := collectDiskUsage(usr)
+	if err != nil {
+		return err
+	}
+
+	if report.IsJSON(systemDfFormat) {
+		return printJSON(usage)
+	}
+
+	rows := make([]diskUsageRow, 0, len(usage.VMs))
+	for _, vmUsage := range usage.VMs {
+		rows = append(rows, diskUsageRow{
+			Id:        vmUsage.Id,
+			RepoTag:   vmUsage.RepoTag,
+			Disk:      humanSize(vmUsage.Disk),
+			CloudInit: humanSize(vmUsage.CloudInit),
+			Keys:      humanSize(vmUsage.Keys),
+			Snapshots: humanSize(vmUsage.Snapshots),
+			Total:     humanSize(vmUsage.DiskUsage.Total),
+			State:     vmUsage.State,
+		})
+	}
+
+	hdrs := report.Headers(diskUsageRow{}, map[string]string{
+		"RepoTag":   "Repo",
+		"CloudInit": "Cloud-init",
+	})
+
+	rpt := report.New(os.Stdout, "system df")
+	rpt, err = rpt.Parse(
+		report.OriginPodman,
+		"{{range . }}{{.Id}}\t{{.RepoTag}}\t{{.Disk}}\t{{.CloudInit}}\t{{.Keys}}\t{{.Snapshots}}\t{{.Total}}\t{{.State}}\n{{end -}}")
+	if err != nil {
+		return err
+	}
+
+	if err := rpt.Execute(hdrs); err != nil {
+		return err
+	}
+
+	if err := rpt.Execute(rows); err != nil {
+		return err
+	}
+
+	if err := rpt.Flush(); err != nil {
+		return err
+	}
+
+	reclaimablePercent := 0
+	if usage.Total > 0 {
+		reclaimablePercent = int(usage.Reclaimable * 100 / usage.Total)
+	}
+	fmt.Printf("\nTotal: %s, reclaimable: %s (%d%%)\n", humanSize(usage.Total), humanSize(usage.Reclaimable), reclaimablePercent)
+	return nil
+}
+
+// collectDiskUsage returns the disk space allocated to the VMs in the cache
+func collectDiskUsage(usr user.User) (*diskUsageReport, error) {
+	usage := &diskUsageReport{VMs: []vmDiskUsage{}}
+	files, err := os.ReadDir(usr.CacheDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return usage, nil
+		}
+		return nil, err
+	}
+
+	for _, f := range files {
+		if !f.IsDir() || len(f.Name()) != 64 {
+			continue
+		}
+
+		vmUsage, err := getVMDiskUsage(usr, f.Name())
+		if err != nil {
+			logrus.Warningf("skipping vm %s reason: %v", f.Name(), err)
+			continue
+		}
+
+		usage.VMs = append(usage.VMs, *vmUsage)
+		usage.Total += vmUsage.DiskUsage.Total
+		if vmUsage.State == vm.StateStopped {
+			usage.Reclaimable += vmUsage.DiskUsage.Total
+		}
+	}
+
+	return usage, nil
+}
+
+func getVMDiskUsage(usr user.User, imageId string) (*vmDiskUsage, error) {
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    imageId,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", imageId, err)
+		}
+	}()
+
+	diskUsage, err := bootcVM.DiskUsage()
+	if err != nil {
+		return nil, err
+	}
+
+	vmUsage := &vmDiskUsage{
+		Id:        imageId[:12],
+		RepoTag:   "<none>",
+		DiskUsage: *diskUsage,
+	}
+
+	// an incomplete installation has no config, but it still uses space
+	if cfg, err := bootcVM.GetConfig(); err == nil {
+		vmUsage.RepoTag = cfg.RepoTag
+	}
+
+	vmUsage.State, err = bootcVM.State()
+	if err != nil {
+		return nil, err
+	}
+	vmUsage.Running = vmUsage.State == vm.StateRunning || vmUsage.State == vm.StatePaused
+
+	return vmUsage, nil
+}
+
+func humanSize(size int64) string {
+	return units.HumanSizeWithPrecision(float64(size), 3)
+}
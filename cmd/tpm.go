@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var tpmCmd = &cobra.Command{
+	Use:   "tpm",
+	Short: "Inspect the TPM of bootc VMs",
+	Long:  "Inspect the TPM of bootc VMs",
+	Args:  cobra.NoArgs,
+}
+
+func init() {
+	RootCmd.AddCommand(tpmCmd)
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/containers/common/pkg/report"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	tpmPcrsCmd = &cobra.Command{
+		Use:   "pcrs <ID>",
+		Short: "Show the measured boot event log of a running VM",
+		Long:  "Show the measured boot event log of a running VM and the PCR values it results in",
+		Args:  cobra.ExactArgs(1),
+		RunE:  doTpmPcrs,
+	}
+
+	tpmPcrsFormat string
+	tpmPcrsPCRs   []uint
+)
+
+func init() {
+	tpmCmd.AddCommand(tpmPcrsCmd)
+	tpmPcrsCmd.Flags().StringVar(&tpmPcrsFormat, "format", "", "Print the event log in the given format, only json is supported")
+	tpmPcrsCmd.Flags().UintSliceVar(&tpmPcrsPCRs, "pcr", nil, "Only show the events and the value of this PCR, can be specified multiple times")
+}
+
+// pcrRow is a PCR line of the tpm pcrs table
+type pcrRow struct {
+	PCR   uint32
+	Value string
+}
+
+func doTpmPcrs(_ *cobra.Command, args []string) error {
+	if tpmPcrsFormat != "" && !report.IsJSON(tpmPcrsFormat) {
+		return fmt.Errorf("unsupported format %q, only json is supported", tpmPcrsFormat)
+	}
+
+	usr, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		User:       usr,
+		LibvirtUri: config.LibvirtUri,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	state, err := bootcVM.State()
+	if err != nil {
+		return fmt.Errorf("unable to get VM %s state: %w", id, err)
+	}
+	if state != vm.StateRunning {
+		return fmt.Errorf("VM %s is %s, not running", id, state)
+	}
+
+	eventLog, err := bootcVM.TPMEventLog()
+	if err != nil {
+		return err
+	}
+
+	if len(tpmPcrsPCRs) > 0 {
+		filterEventLog(eventLog, tpmPcrsPCRs)
+	}
+
+	if report.IsJSON(tpmPcrsFormat) {
+		return printJSON(eventLog)
+	}
+
+	rpt := report.New(os.Stdout, "tpm pcrs")
+	rpt, err = rpt.Parse(
+		report.OriginPodman,
+		"{{range . }}{{.PCR}}\t{{.Type}}\t{{.Digest}}\t{{.Description}}\n{{end -}}")
+	if err != nil {
+		return err
+	}
+
+	if err := rpt.Execute(report.Headers(vm.Event{}, map[string]string{"Digest": eventLog.Algorithm})); err != nil {
+		return err
+	}
+
+	if err := rpt.Execute(eventLog.Events); err != nil {
+		return err
+	}
+
+	if err := rpt.Flush(); err != nil {
+		return err
+	}
+
+	rows := make([]pcrRow, 0, len(eventLog.PCRs))
+	for pcr, value := range eventLog.PCRs {
+		rows = append(rows, pcrRow{PCR: pcr, Value: value})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].PCR < rows[j].PCR })
+
+	fmt.Println()
+	pcrRpt := report.New(os.Stdout, "tpm pcrs values")
+	pcrRpt, err = pcrRpt.Parse(report.OriginPodman, "{{range . }}{{.PCR}}\t{{.Value}}\n{{end -}}")
+	if err != nil {
+		return err
+	}
+
+	if err := pcrRpt.Execute(report.Headers(pcrRow{}, map[string]string{"Value": eventLog.Algorithm + " value"})); err != nil {
+		return err
+	}
+
+	if err := pcrRpt.Execute(rows); err != nil {
+		return err
+	}
+
+	return pcrRpt.Flush()
+}
+
+// filterEventLog only keeps the events and the values of the given PCRs
+func filterEventLog(eventLog *vm.EventLog, pcrs []uint) {
+	keep := func(pcr uint32) bool {
+		return slices.Contains(pcrs, uint(pcr))
+	}
+
+	eventLog.Events = slices.DeleteFunc(eventLog.Events, func(event vm.Event) bool {
+		return !keep(event.PCR)
+	})
+
+	for pcr := range eventLog.PCRs {
+		if !keep(pcr) {
+			delete(eventLog.PCRs, pcr)
+		}
+	}
+}
@@ -3,7 +3,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -24,21 +23,24 @@ var (
 		Args:   cobra.ExactArgs(4),
 		RunE:   doMon,
 	}
-	console bool
+	console    bool
+	monRestart string
 )
 
 func init() {
 	RootCmd.AddCommand(monCmd)
+	monCmd.Flags().StringVar(&monRestart, "restart", vm.RestartNo, "Restart policy of the VM")
 	runCmd.Flags().BoolVar(&console, "console", false, "Show boot console")
 }
 
-func doMon(_ *cobra.Command, args []string) error {
+func doMon(flags *cobra.Command, args []string) error {
 	usr, err := user.NewUser()
 	if err != nil {
 		return err
 	}
 
-	ctx := context.Background()
+	// The context is cancelled on SIGINT, stopping krunkit and gvproxy
+	ctx := flags.Context()
 	fullImageId := args[0]
 	username := args[1]
 	sshIdentity := args[2]
@@ -57,11 +59,14 @@ func doMon(_ *cobra.Command, args []string) error {
 	}
 
 	params := vm.MonitorParmeters{
+		User:        usr,
+		ImageID:     fullImageId,
 		CacheDir:    cacheDir,
 		RunDir:      runDir,
 		Username:    username,
 		SshIdentity: sshIdentity,
 		SshPort:     sshPort,
+		Restart:     monRestart,
 	}
 
 	return vm.StartMonitor(ctx, params)
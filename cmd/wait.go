@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var (
+	waitCmd = &cobra.Command{
+		Use:   "wait ID",
+		Short: "Wait for a running VM to be ready",
+		Long:  "Wait for a running VM to be ready, checking readiness probes over SSH",
+		Args:  cobra.ExactArgs(1),
+		RunE:  doWait,
+	}
+
+	waitFor     []string
+	waitTimeout time.Duration
+)
+
+func init() {
+	RootCmd.AddCommand(waitCmd)
+	waitCmd.Flags().StringArrayVar(&waitFor, "for", nil, "Readiness probe: ssh, vsock, systemd, unit=<name>, port=<n> or cmd=<script>, can be specified multiple times (default: ssh, vsock for the VMs run with --vsock)")
+	waitCmd.Flags().DurationVar(&waitTimeout, "timeout", 0, "How long to wait for the VM to be ready, e.g. 5m (default: 1m)")
+}
+
+func doWait(flags *cobra.Command, args []string) (err error) {
+	probes, err := parseReadinessProbes(waitFor)
+	if err != nil {
+		return err
+	}
+
+	user, err := user.NewUser()
+	if err != nil {
+		return err
+	}
+
+	id := args[0]
+	bootcVM, err := vm.NewVM(vm.NewVMParameters{
+		ImageID:    id,
+		LibvirtUri: config.LibvirtUri,
+		User:       user,
+		Locking:    utils.Shared,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Let's be explicit instead of relying on the defer exec order
+	defer func() {
+		bootcVM.CloseConnection()
+		if err := bootcVM.Unlock(); err != nil {
+			logrus.Warningf("unable to unlock VM %s: %v", id, err)
+		}
+	}()
+
+	state, err := bootcVM.State()
+	if err != nil {
+		return fmt.Errorf("unable to get the VM state: %w", err)
+	}
+	if state != vm.StateRunning {
+		return fmt.Errorf("VM %s is %s, it must be running", id, state)
+	}
+
+	return bootcVM.WaitForReady(flags.Context(), probes, waitTimeout)
+}
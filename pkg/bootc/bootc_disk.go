@@ -8,11 +8,12 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"sync"
+	"slices"
 	"syscall"
 	"time"
 
 	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/events"
 	"github.com/containers/podman-bootc/pkg/user"
 	"github.com/containers/podman-bootc/pkg/utils"
 
@@ -32,17 +33,60 @@ const containerSizeToDiskSizeMultiplier = 2
 const diskSizeMinimum = 10 * 1024 * 1024 * 1024 // 10GB
 const imageMetaXattr = "user.bootc.meta"
 
+// How long to wait for the podman client to exit after being interrupted
+const installContainerStopTimeout = 10 * time.Second
+
 // DiskImageConfig defines configuration for the
 type DiskImageConfig struct {
-	Filesystem  string
-	RootSizeMax string
-	DiskSize    string
+	Filesystem                    string
+	RootSizeMax                   string
+	DiskSize                      string
+	KernelArgs                    []string
+	TargetImgRef                  string
+	Stateroot                     string
+	TargetNoSignatureVerification bool
 }
 
-// diskFromContainerMeta is serialized to JSON in a user xattr on a disk image
-type diskFromContainerMeta struct {
+// DiskMeta is serialized to JSON in a user xattr on a disk image
+type DiskMeta struct {
 	// imageDigest is the digested sha256 of the container that was used to build this disk
 	ImageDigest string `json:"imageDigest"`
+	// The remaining fields are the bootc install options baked into the disk,
+	// a change in any of them requires a new installation
+	KernelArgs                    []string `json:"kernelArgs,omitempty"`
+	TargetImgRef                  string   `json:"targetImgRef,omitempty"`
+	Stateroot                     string   `json:"stateroot,omitempty"`
+	TargetNoSignatureVerification bool     `json:"targetNoSignatureVerification,omitempty"`
+	// Verification is set when the image signatures were verified before installing it
+	Verification *ImageVerification `json:"verification,omitempty"`
+}
+
+// ImageVerification records a successful verification of the image signatures
+type ImageVerification struct {
+	// Reference is the verified registry image, as repository@digest
+	Reference string `json:"reference"`
+	// Policy is the path of the signature policy, empty for the default one
+	Policy     string    `json:"policy,omitempty"`
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+func newDiskMeta(imageDigest string, diskConfig DiskImageConfig) DiskMeta {
+	return DiskMeta{
+		ImageDigest:                   imageDigest,
+		KernelArgs:                    diskConfig.KernelArgs,
+		TargetImgRef:                  diskConfig.TargetImgRef,
+		Stateroot:                     diskConfig.Stateroot,
+		TargetNoSignatureVerification: diskConfig.TargetNoSignatureVerification,
+	}
+}
+
+// equal reports whether two disks were built from the same image using the same install options
+func (m DiskMeta) equal(other DiskMeta) bool {
+	return m.ImageDigest == other.ImageDigest &&
+		slices.Equal(m.KernelArgs, other.KernelArgs) &&
+		m.TargetImgRef == other.TargetImgRef &&
+		m.Stateroot == other.Stateroot &&
+		m.TargetNoSignatureVerification == other.TargetNoSignatureVerification
 }
 
 type BootcDisk struct {
@@ -52,27 +96,27 @@ type BootcDisk struct {
 	ImageId                 string
 	imageData               *types.ImageInspectReport
 	RepoTag                 string
+	Arch                    string
 	CreatedAt               time.Time
 	Directory               string
 	file                    *os.File
 	bootcInstallContainerId string
+	// LockTimeout is how long Install waits for another process using the
+	// VM cache dir, e.g. installing the same image, before failing
+	LockTimeout time.Duration
+	// PullOptions configures how Install fetches the image
+	PullOptions utils.PullOptions
+	// VerifyOptions configures the verification of the image signatures before installing it
+	VerifyOptions utils.VerifyOptions
+	verification  *ImageVerification
 }
 
-// create singleton for easy cleanup
-var (
-	instance     *BootcDisk
-	instanceOnce sync.Once
-)
-
 func NewBootcDisk(imageNameOrId string, ctx context.Context, user user.User) *BootcDisk {
-	instanceOnce.Do(func() {
-		instance = &BootcDisk{
-			ImageNameOrId: imageNameOrId,
-			Ctx:           ctx,
-			User:          user,
-		}
-	})
-	return instance
+	return &BootcDisk{
+		ImageNameOrId: imageNameOrId,
+		Ctx:           ctx,
+		User:          user,
+	}
 }
 
 func (p *BootcDisk) GetDirectory() string {
@@ -98,28 +142,43 @@ func (p *BootcDisk) GetRepoTag() string {
 	return p.RepoTag
 }
 
+// GetArch returns the architecture of the container image, e.g. aarch64
+func (p *BootcDisk) GetArch() string {
+	return p.Arch
+}
+
 // GetCreatedAt returns the creation time of the disk image
 func (p *BootcDisk) GetCreatedAt() time.Time {
 	return p.CreatedAt
 }
 
-func (p *BootcDisk) Install(quiet bool, config DiskImageConfig) (err error) {
+// Install pulls the image and installs it to a disk in the VM cache dir, reusing
+// an existing disk if it is up to date. Cancelling ctx aborts the installation,
+// removing the temporary disk and the install container.
+func (p *BootcDisk) Install(ctx context.Context, quiet bool, config DiskImageConfig) (err error) {
 	p.CreatedAt = time.Now()
 
-	err = p.pullImage()
+	err = p.pullImage(ctx)
 	if err != nil {
 		return
 	}
 
+	if p.VerifyOptions.Enabled() {
+		err = p.verifyImage(ctx)
+		if err != nil {
+			return
+		}
+	}
+
 	// Create VM cache dir; one per oci bootc image
 	p.Directory = filepath.Join(p.User.CacheDir(), p.ImageId)
 	lock := utils.NewCacheLock(p.User.RunDir(), p.Directory)
-	locked, err := lock.TryLock(utils.Exclusive)
+	locked, err := lock.TryLockWithTimeout(ctx, utils.Exclusive, p.LockTimeout)
 	if err != nil {
 		return fmt.Errorf("error locking the VM cache path: %w", err)
 	}
 	if !locked {
-		return fmt.Errorf("unable to lock the VM cache path")
+		return fmt.Errorf("unable to lock the VM cache path, it is in use by another podman-bootc process")
 	}
 
 	defer func() {
@@ -132,7 +191,16 @@ func (p *BootcDisk) Install(quiet bool, config DiskImageConfig) (err error) {
 		return fmt.Errorf("error while making bootc disk directory: %w", err)
 	}
 
-	err = p.getOrInstallImageToDisk(quiet, config)
+	defer func() {
+		if err == nil {
+			return
+		}
+		if err := p.Cleanup(); err != nil {
+			logrus.Errorf("unable to cleanup bootc install: %v", err)
+		}
+	}()
+
+	err = p.getOrInstallImageToDisk(ctx, quiet, config)
 	if err != nil {
 		return
 	}
@@ -143,20 +211,27 @@ func (p *BootcDisk) Install(quiet bool, config DiskImageConfig) (err error) {
 	return
 }
 
+// Cleanup removes the bootc install container, if any. It uses the podman
+// connection context, so it still works after the installation was interrupted.
 func (p *BootcDisk) Cleanup() (err error) {
 	force := true
+	ignore := true
 	if p.bootcInstallContainerId != "" {
-		_, err := containers.Remove(p.Ctx, p.bootcInstallContainerId, &containers.RemoveOptions{Force: &force})
+		_, err := containers.Remove(p.Ctx, p.bootcInstallContainerId, &containers.RemoveOptions{Force: &force, Ignore: &ignore})
 		if err != nil {
 			return fmt.Errorf("failed to remove bootc install container: %w", err)
 		}
+		p.bootcInstallContainerId = ""
 	}
 
 	return
 }
 
 // getOrInstallImageToDisk checks if the disk is present and if not, installs the image to a new disk
-func (p *BootcDisk) getOrInstallImageToDisk(quiet bool, diskConfig DiskImageConfig) error {
+func (p *BootcDisk) getOrInstallImageToDisk(ctx context.Context, quiet bool, diskConfig DiskImageConfig) error {
+	// the implicit target image is baked into the disk too
+	diskConfig.TargetImgRef = p.targetImgRef(diskConfig)
+
 	diskPath := filepath.Join(p.Directory, config.DiskImage)
 	f, err := os.Open(diskPath)
 	if err != nil {
@@ -164,31 +239,87 @@ func (p *BootcDisk) getOrInstallImageToDisk(quiet bool, diskConfig DiskImageConf
 			return err
 		}
 		logrus.Debugf("No existing disk image found")
-		return p.bootcInstallImageToDisk(quiet, diskConfig)
+		return p.bootcInstallImageToDisk(ctx, quiet, diskConfig)
 	}
 	logrus.Debug("Found existing disk image, comparing digest")
 	defer f.Close()
-	buf := make([]byte, 4096)
-	len, err := unix.Fgetxattr(int(f.Fd()), imageMetaXattr, buf)
+	buf, err := readXattr(func(dest []byte) (int, error) {
+		return unix.Fgetxattr(int(f.Fd()), imageMetaXattr, dest)
+	})
 	if err != nil {
 		// If there's no xattr, just remove it
 		os.Remove(diskPath)
 		logrus.Debugf("No %s xattr found", imageMetaXattr)
-		return p.bootcInstallImageToDisk(quiet, diskConfig)
+		return p.bootcInstallImageToDisk(ctx, quiet, diskConfig)
 	}
-	bufTrimmed := buf[:len]
-	var serializedMeta diskFromContainerMeta
-	if err := json.Unmarshal(bufTrimmed, &serializedMeta); err != nil {
+	var serializedMeta DiskMeta
+	if err := json.Unmarshal(buf, &serializedMeta); err != nil {
 		logrus.Warnf("failed to parse serialized meta from %s (%v) %v", diskPath, buf, err)
-		return p.bootcInstallImageToDisk(quiet, diskConfig)
+		return p.bootcInstallImageToDisk(ctx, quiet, diskConfig)
 	}
 
 	logrus.Debugf("previous disk digest: %s current digest: %s", serializedMeta.ImageDigest, p.ImageId)
-	if serializedMeta.ImageDigest == p.ImageId {
+	if serializedMeta.equal(newDiskMeta(p.ImageId, diskConfig)) {
+		// the disk content doesn't depend on the verification, only record the new one
+		if p.verification != nil {
+			serializedMeta.Verification = p.verification
+			return setDiskMeta(f, serializedMeta)
+		}
 		return nil
 	}
+	logrus.Debugf("disk image or install options changed, reinstalling")
+
+	return p.bootcInstallImageToDisk(ctx, quiet, diskConfig)
+}
+
+// readXattr reads a whole xattr with get, the metadata has no size limit so its size is
+// queried first
+func readXattr(get func(dest []byte) (int, error)) ([]byte, error) {
+	for {
+		size, err := get(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, size)
+		n, err := get(buf)
+		if errors.Is(err, unix.ERANGE) {
+			// the xattr grew since its size was queried
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+}
 
-	return p.bootcInstallImageToDisk(quiet, diskConfig)
+// setDiskMeta serializes the metadata to the disk image xattr
+func setDiskMeta(f *os.File, meta DiskMeta) error {
+	buf, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := unix.Fsetxattr(int(f.Fd()), imageMetaXattr, buf, 0); err != nil {
+		return fmt.Errorf("failed to set xattr: %w", err)
+	}
+	return nil
+}
+
+// LoadDiskMeta returns the metadata of a disk image, describing how it was installed
+func LoadDiskMeta(diskPath string) (*DiskMeta, error) {
+	buf, err := readXattr(func(dest []byte) (int, error) {
+		return unix.Getxattr(diskPath, imageMetaXattr, dest)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading %s xattr: %w", imageMetaXattr, err)
+	}
+
+	meta := new(DiskMeta)
+	if err := json.Unmarshal(buf, meta); err != nil {
+		return nil, fmt.Errorf("parsing %s xattr: %w", imageMetaXattr, err)
+	}
+	return meta, nil
 }
 
 func align(size int64, align int64) int64 {
@@ -200,12 +331,20 @@ func align(size int64, align int64) int64 {
 }
 
 // bootcInstallImageToDisk creates a disk image from a bootc container
-func (p *BootcDisk) bootcInstallImageToDisk(quiet bool, diskConfig DiskImageConfig) (err error) {
+func (p *BootcDisk) bootcInstallImageToDisk(ctx context.Context, quiet bool, diskConfig DiskImageConfig) (err error) {
 	fmt.Printf("Executing `bootc install to-disk` from container image %s to create disk image\n", p.RepoTag)
-	p.file, err = os.CreateTemp(p.Directory, "podman-bootc-tempdisk")
+	p.file, err = os.CreateTemp(p.Directory, config.TempDiskPrefix)
 	if err != nil {
 		return err
 	}
+	doCleanupDisk := true
+	defer func() {
+		p.file.Close()
+		if doCleanupDisk {
+			os.Remove(p.file.Name())
+		}
+	}()
+
 	size := p.imageData.Size * containerSizeToDiskSizeMultiplier
 	if size < diskSizeMinimum {
 		size = diskSizeMinimum
@@ -229,27 +368,16 @@ func (p *BootcDisk) bootcInstallImageToDisk(quiet bool, diskConfig DiskImageConf
 		return err
 	}
 	logrus.Debugf("Created %s with size %v", p.file.Name(), size)
-	doCleanupDisk := true
-	defer func() {
-		if doCleanupDisk {
-			os.Remove(p.file.Name())
-		}
-	}()
 
-	err = p.runInstallContainer(quiet, diskConfig)
+	err = p.runInstallContainer(ctx, quiet, diskConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create disk image: %w", err)
 	}
-	serializedMeta := diskFromContainerMeta{
-		ImageDigest: p.ImageId,
-	}
-	buf, err := json.Marshal(serializedMeta)
-	if err != nil {
+	serializedMeta := newDiskMeta(p.ImageId, diskConfig)
+	serializedMeta.Verification = p.verification
+	if err := setDiskMeta(p.file, serializedMeta); err != nil {
 		return err
 	}
-	if err := unix.Fsetxattr(int(p.file.Fd()), imageMetaXattr, buf, 0); err != nil {
-		return fmt.Errorf("failed to set xattr: %w", err)
-	}
 	diskPath := filepath.Join(p.Directory, config.DiskImage)
 
 	if err := os.Rename(p.file.Name(), diskPath); err != nil {
@@ -257,12 +385,16 @@ func (p *BootcDisk) bootcInstallImageToDisk(quiet bool, diskConfig DiskImageConf
 	}
 	doCleanupDisk = false
 
+	events.Record(p.User, p.ImageId, events.Install, p.RepoTag)
 	return nil
 }
 
 // pullImage fetches the container image if not present
-func (p *BootcDisk) pullImage() error {
-	imageData, err := utils.PullAndInspect(p.Ctx, p.ImageNameOrId)
+func (p *BootcDisk) pullImage(ctx context.Context) error {
+	pullCtx, cancel := utils.WithCancelOf(p.Ctx, ctx)
+	defer cancel()
+
+	imageData, err := utils.PullAndInspect(pullCtx, p.ImageNameOrId, p.PullOptions)
 	if err != nil {
 		return err
 	}
@@ -273,13 +405,51 @@ func (p *BootcDisk) pullImage() error {
 		p.RepoTag = imageData.RepoTags[0]
 	}
 
+	p.Arch, err = utils.ArchFromOCI(imageData.Architecture)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// verifyImage checks the signatures of the pulled image against the signature policy
+func (p *BootcDisk) verifyImage(ctx context.Context) error {
+	fmt.Printf("Verifying the signatures of %s\n", p.ImageNameOrId)
+	verifiedRef, err := utils.VerifyImage(ctx, p.imageData, p.VerifyOptions, p.PullOptions)
+	if err != nil {
+		return fmt.Errorf("image signature verification failed: %w", err)
+	}
+
+	p.verification = &ImageVerification{
+		Reference:  verifiedRef,
+		VerifiedAt: time.Now(),
+	}
+	if p.VerifyOptions.PolicyPath != "" {
+		p.verification.Policy, err = filepath.Abs(p.VerifyOptions.PolicyPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// targetImgRef returns the image bootc tracks for updates. A verified image is installed
+// by ID, so it tracks the image name unless another target image is given.
+func (p *BootcDisk) targetImgRef(config DiskImageConfig) string {
+	if config.TargetImgRef == "" && p.verification != nil {
+		return p.RepoTag
+	}
+	return config.TargetImgRef
+}
+
 // runInstallContainer runs the bootc installer in a container to create a disk image
-func (p *BootcDisk) runInstallContainer(quiet bool, config DiskImageConfig) error {
-	c := p.createInstallContainer(config)
+func (p *BootcDisk) runInstallContainer(ctx context.Context, quiet bool, config DiskImageConfig) error {
+	c := p.createInstallContainer(ctx, config)
 	if err := c.Run(); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("install interrupted: %w", ctx.Err())
+		}
 		return fmt.Errorf("failed to invoke install: %w", err)
 	}
 	return nil
@@ -288,7 +458,7 @@ func (p *BootcDisk) runInstallContainer(quiet bool, config DiskImageConfig) erro
 // createInstallContainer creates a podman command to run the bootc installer.
 // Note: This code used to use the Go bindings for the podman remote client, but the
 // Attach interface currently leaks goroutines.
-func (p *BootcDisk) createInstallContainer(config DiskImageConfig) *exec.Cmd {
+func (p *BootcDisk) createInstallContainer(ctx context.Context, config DiskImageConfig) *exec.Cmd {
 	bootcInstallArgs := []string{
 		"bootc", "install", "to-disk", "--via-loopback", "--generic-image",
 		"--skip-fetch-check",
@@ -299,30 +469,64 @@ func (p *BootcDisk) createInstallContainer(config DiskImageConfig) *exec.Cmd {
 	if config.RootSizeMax != "" {
 		bootcInstallArgs = append(bootcInstallArgs, "--root-size="+config.RootSizeMax)
 	}
+	for _, karg := range config.KernelArgs {
+		bootcInstallArgs = append(bootcInstallArgs, "--karg", karg)
+	}
+	if config.TargetImgRef != "" {
+		bootcInstallArgs = append(bootcInstallArgs, "--target-imgref", config.TargetImgRef)
+	}
+	if config.Stateroot != "" {
+		bootcInstallArgs = append(bootcInstallArgs, "--stateroot", config.Stateroot)
+	}
+	if config.TargetNoSignatureVerification {
+		bootcInstallArgs = append(bootcInstallArgs, "--target-no-signature-verification")
+	}
 	bootcInstallArgs = append(bootcInstallArgs, "/output/"+filepath.Base(p.file.Name()))
 
 	// Basic config:
 	// - force on --remote because we depend on podman machine.
 	// - add privileged, pid=host, SELinux config and bind mounts per https://containers.github.io/bootc/bootc-install.html
 	// - we need force running as root (i.e., --user=root:root) to overwrite any possible USER directive in the Containerfile
+	// - name the container, so it can be removed if the install is interrupted
+	p.bootcInstallContainerId = installContainerName(p.ImageId)
 	podmanArgs := []string{"--remote", "run", "--rm", "-i", "--pid=host", "--user=root:root", "--privileged", "--security-opt=label=type:unconfined_t", "--volume=/dev:/dev", "--volume=/var/lib/containers:/var/lib/containers"}
+	podmanArgs = append(podmanArgs, "--name="+p.bootcInstallContainerId)
 	// Custom bind mounts
 	podmanArgs = append(podmanArgs, fmt.Sprintf("--volume=%s:/output", p.Directory))
 	if term.IsTerminal(int(os.Stdin.Fd())) {
 		podmanArgs = append(podmanArgs, "-t")
 	}
+	// Foreign images run the installer under emulation, this requires qemu-user-static in the podman machine
+	if p.Arch != utils.HostArch() {
+		podmanArgs = append(podmanArgs, "--platform=linux/"+p.imageData.Architecture)
+	}
 	// Other conditional arguments
 	if v, ok := os.LookupEnv("BOOTC_INSTALL_LOG"); ok {
 		podmanArgs = append(podmanArgs, fmt.Sprintf("--env=RUST_LOG=%s", v))
 	}
-	// The image name
-	podmanArgs = append(podmanArgs, p.ImageNameOrId)
+	// The image name. A verified image is pinned by ID, in case its tag moved since the verification,
+	// so bootc needs the name to track for updates.
+	if p.verification != nil {
+		podmanArgs = append(podmanArgs, p.ImageId)
+	} else {
+		podmanArgs = append(podmanArgs, p.ImageNameOrId)
+	}
 	// And the remaining arguments for bootc install
 	podmanArgs = append(podmanArgs, bootcInstallArgs...)
 
-	c := exec.Command("podman", podmanArgs...)
+	c := exec.CommandContext(ctx, "podman", podmanArgs...)
+	c.Cancel = func() error {
+		return c.Process.Signal(os.Interrupt)
+	}
+	c.WaitDelay = installContainerStopTimeout
 	c.Stdin = os.Stdin
 	c.Stdout = os.Stdout
 	c.Stderr = os.Stderr
 	return c
 }
+
+// installContainerName returns the name of the container running the bootc installer.
+// It is unique to the podman-bootc process, so another process never removes it.
+func installContainerName(imageId string) string {
+	return fmt.Sprintf("%s-install-%s-%d", config.ProjectName, imageId[:12], os.Getpid())
+}
@@ -1,13 +1,22 @@
 package config
 
 const (
-	ProjectName      = "podman-bootc"
-	CacheDir         = ".cache"
-	RunPidFile       = "run.pid"
-	OciArchiveOutput = "image-archive.tar"
-	DiskImage        = "disk.raw"
-	CiDataIso        = "cidata.iso"
-	SshKeyFile       = "sshkey"
-	CfgFile          = "bc.cfg"
-	LibvirtUri       = "qemu:///session"
+	ProjectName       = "podman-bootc"
+	CacheDir          = ".cache"
+	RunPidFile        = "run.pid"
+	OciArchiveOutput  = "image-archive.tar"
+	DiskImage         = "disk.raw"
+	TempDiskPrefix    = "podman-bootc-tempdisk"
+	CiDataIso         = "cidata.iso"
+	TPMStateDir       = "tpm"
+	SnapshotsDir      = "snapshots"
+	SavedStateFile    = "saved-state"
+	EventsLogFile     = "events.log"
+	VsockTokenFile    = "vsock-token"
+	SshKeyFile        = "sshkey"
+	SshHostKeyFile    = "ssh_host_rsa_key"
+	SshKnownHostsFile = "known_hosts"
+	SshConfigFile     = "ssh_config"
+	CfgFile           = "bc.cfg"
+	LibvirtUri        = "qemu:///session"
 )
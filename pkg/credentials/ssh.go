@@ -1,6 +1,7 @@
 package credentials
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -16,27 +17,53 @@ func Generatekeys(outputDir string) (string, error) {
 	_ = os.Remove(sshIdentity)
 	_ = os.Remove(sshIdentity + ".pub")
 
+	if err := sshKeygen(sshIdentity); err != nil {
+		return "", fmt.Errorf("failed to generate ssh keys: %w", err)
+	}
+	return sshIdentity, nil
+}
+
+// GenerateHostKey creates the RSA SSH host key of the VM, unless it already exists, so
+// the host key stays the same across the VM runs
+func GenerateHostKey(outputDir string) (string, error) {
+	hostKey := filepath.Join(outputDir, config.SshHostKeyFile)
+	_, err := os.Stat(hostKey + ".pub")
+	if err == nil {
+		return hostKey, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	_ = os.Remove(hostKey)
+	if err := sshKeygen(hostKey); err != nil {
+		return "", fmt.Errorf("failed to generate the ssh host key: %w", err)
+	}
+	return hostKey, nil
+}
+
+func sshKeygen(path string) error {
 	// we use RSA here so it works on FIPS mode
-	args := []string{"-N", "", "-t", "rsa", "-f", sshIdentity}
+	args := []string{"-N", "", "-t", "rsa", "-f", path}
 	cmd := exec.Command("ssh-keygen", args...)
 	stdErr, err := cmd.StderrPipe()
 	if err != nil {
-		return "", fmt.Errorf("ssh key generation: redirecting stderr: %w", err)
+		return fmt.Errorf("ssh key generation: redirecting stderr: %w", err)
 	}
 
 	if err := cmd.Start(); err != nil {
-		return "", fmt.Errorf("ssh key generation: executing ssh-keygen: %w", err)
+		return fmt.Errorf("ssh key generation: executing ssh-keygen: %w", err)
 	}
 
 	waitErr := cmd.Wait()
 	if waitErr == nil {
-		return sshIdentity, nil
+		return nil
 	}
 
 	errMsg, err := io.ReadAll(stdErr)
 	if err != nil {
-		return "", fmt.Errorf("ssh key generation, unable to read from stderr: %w", waitErr)
+		return fmt.Errorf("ssh key generation, unable to read from stderr: %w", waitErr)
 	}
 
-	return "", fmt.Errorf("failed to generate ssh keys: %s: %w", string(errMsg), waitErr)
+	return fmt.Errorf("%s: %w", string(errMsg), waitErr)
 }
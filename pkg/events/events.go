@@ -0,0 +1,199 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Lifecycle statuses, reported by libvirt. podman-bootc also records the start, stop,
+// pause and unpause it drives.
+const (
+	Start   = "start"
+	Stop    = "stop"
+	Crash   = "crash"
+	Reboot  = "reboot"
+	Pause   = "pause"
+	Unpause = "unpause"
+)
+
+// podman-bootc statuses, recorded in the event log
+const (
+	Install  = "install"
+	Remove   = "remove"
+	SSHReady = "ssh-ready"
+)
+
+// IsLifecycle reports whether the status is a lifecycle one
+func IsLifecycle(status string) bool {
+	switch status {
+	case Start, Stop, Crash, Reboot, Pause, Unpause:
+		return true
+	}
+	return false
+}
+
+// followInterval is how often the event log is checked for new events
+const followInterval = 500 * time.Millisecond
+
+// Event is something that happened to a VM
+type Event struct {
+	Time time.Time
+	// Id is the short image ID of the VM
+	Id     string
+	Status string
+	// Detail completes the status, e.g. the reason a VM stopped
+	Detail string `json:",omitempty"`
+}
+
+// New returns an event of the VM happening now
+func New(id string, status string, detail string) Event {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+	return Event{Time: time.Now(), Id: id, Status: status, Detail: detail}
+}
+
+func logPath(usr user.User) string {
+	return filepath.Join(usr.CacheDir(), config.EventsLogFile)
+}
+
+// Record appends an event of the VM to the event log. Failing to record an event
+// doesn't fail the operation it reports, it is only logged.
+func Record(usr user.User, id string, status string, detail string) {
+	if err := record(usr, New(id, status, detail)); err != nil {
+		logrus.Warningf("unable to record the %s event of VM %s: %v", status, id, err)
+	}
+}
+
+func record(usr user.User, event Event) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(usr.CacheDir(), os.ModePerm); err != nil {
+		return err
+	}
+
+	// each event is a single append, the events of concurrent processes don't interleave
+	f, err := os.OpenFile(logPath(usr), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(line, '\n'))
+	return err
+}
+
+// Last returns the last event of the VM recorded in the event log with one of the statuses,
+// false when there is none
+func Last(usr user.User, id string, statuses ...string) (Event, bool, error) {
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	f, err := os.Open(logPath(usr))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Event{}, false, nil
+		}
+		return Event{}, false, err
+	}
+	defer f.Close()
+
+	var last Event
+	found := false
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// a partial line is an event being written
+			return last, found, nil
+		}
+		if err != nil {
+			return Event{}, false, err
+		}
+
+		var event Event
+		if err := json.Unmarshal(line, &event); err != nil {
+			continue
+		}
+		if event.Id == id && slices.Contains(statuses, event.Status) {
+			last, found = event, true
+		}
+	}
+}
+
+// Follow reports the events of the event log that happened after since, then, if stream
+// is set, the events recorded later on until ctx is done. With a zero since, only the
+// events recorded later on are reported.
+func Follow(ctx context.Context, usr user.User, since time.Time, stream bool, report func(Event)) error {
+	f, err := os.Open(logPath(usr))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// the log is created by the first recorded event
+	for f == nil {
+		if !stream {
+			return nil
+		}
+		if err := utils.SleepWithContext(ctx, followInterval); err != nil {
+			return err
+		}
+		f, err = os.Open(logPath(usr))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	defer f.Close()
+
+	if since.IsZero() {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	reader := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+
+		// wait for the rest of a line being written
+		partial = append(partial, line...)
+		if errors.Is(err, io.EOF) {
+			if !stream {
+				return nil
+			}
+			if err := utils.SleepWithContext(ctx, followInterval); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var event Event
+		if err := json.Unmarshal(partial, &event); err != nil {
+			logrus.Warningf("skipping invalid event %q: %v", partial, err)
+		} else if event.Time.After(since) {
+			report(event)
+		}
+		partial = nil
+	}
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// ociArchitectures maps the architectures supported by podman-bootc, using
+// the kernel names as libvirt does, to their OCI image names
+var ociArchitectures = map[string]string{
+	"x86_64":  "amd64",
+	"aarch64": "arm64",
+	"s390x":   "s390x",
+	"ppc64le": "ppc64le",
+}
+
+// OCIArch returns the OCI image architecture name of arch, e.g. arm64 for aarch64
+func OCIArch(arch string) (string, error) {
+	ociArch, ok := ociArchitectures[arch]
+	if !ok {
+		return "", fmt.Errorf("unsupported architecture %q, use one of x86_64, aarch64, s390x or ppc64le", arch)
+	}
+	return ociArch, nil
+}
+
+// ArchFromOCI returns the kernel architecture name of an OCI image architecture
+func ArchFromOCI(ociArch string) (string, error) {
+	for arch, name := range ociArchitectures {
+		if name == ociArch {
+			return arch, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported image architecture %q", ociArch)
+}
+
+// HostArch returns the kernel architecture name of the host
+func HostArch() string {
+	arch, err := ArchFromOCI(runtime.GOARCH)
+	if err != nil {
+		return runtime.GOARCH
+	}
+	return arch
+}
@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// WithCancelOf returns a copy of ctx, keeping its values, that is also
+// cancelled when cancelCtx is done. It is used to make the podman bindings
+// connection context honor the user interruption.
+func WithCancelOf(ctx, cancelCtx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(cancelCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// SleepWithContext pauses the current goroutine for at least the duration d,
+// returning early with the context error if ctx is done
+func SleepWithContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 	"os/exec"
 )
 
@@ -12,9 +13,22 @@ const (
 ******************************************************************
 `
 	// PodmanMachineErrorMessage = "\n**** A rootful Podman machine is required to run podman-bootc ****\n"
+
+	// InterruptedExitCode is the exit code used when podman-bootc is
+	// interrupted by a signal, following the shell convention 128+SIGINT
+	InterruptedExitCode = 130
 )
 
-// SetExitCode set the exit code for exec.ExitError errors, and no
+// ExitCodeError is the error of a command run in a VM exiting with a non zero exit code
+type ExitCodeError struct {
+	Code int
+}
+
+func (e *ExitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// SetExitCode set the exit code for exec.ExitError and ExitCodeError errors, and no
 // error is returned
 func WithExitCode(err error) (int, error) {
 	if err == nil {
@@ -25,5 +39,10 @@ func WithExitCode(err error) (int, error) {
 	if errors.As(err, &exitError) {
 		return exitError.ExitCode(), nil
 	}
+
+	var exitCodeError *ExitCodeError
+	if errors.As(err, &exitCodeError) {
+		return exitCodeError.Code, nil
+	}
 	return 1, err
 }
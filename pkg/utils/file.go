@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strconv"
+	"syscall"
 	"time"
 )
 
@@ -60,3 +63,28 @@ func WaitForFileWithBackoffs(maxBackoffs int, backoff time.Duration, path string
 	}
 	return fmt.Errorf("unable to find file at %q", path)
 }
+
+// AllocatedSize returns the disk space used by a file, or by all the files in a
+// directory tree. Unlike the apparent size, it doesn't count the holes of sparse
+// files, like the VM disk images.
+func AllocatedSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		if st, ok := info.Sys().(*syscall.Stat_t); ok {
+			size += int64(st.Blocks) * 512
+		} else {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
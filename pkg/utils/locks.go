@@ -1,7 +1,12 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/gofrs/flock"
 )
@@ -13,6 +18,9 @@ const (
 	Shared
 )
 
+// How often a busy lock is retried while waiting for it
+const lockRetryDelay = 250 * time.Millisecond
+
 type CacheLock struct {
 	inner *flock.Flock
 }
@@ -35,6 +43,33 @@ func (l CacheLock) TryLock(mode AccessMode) (bool, error) {
 	}
 }
 
+// TryLockWithTimeout behaves like TryLock, but if the lock is busy it keeps
+// retrying until the lock is taken or the timeout expires, returning false in
+// the latter case. A zero timeout doesn't wait at all. It returns an error if
+// ctx is cancelled while waiting.
+func (l CacheLock) TryLockWithTimeout(ctx context.Context, mode AccessMode, timeout time.Duration) (bool, error) {
+	locked, err := l.TryLock(mode)
+	if err != nil || locked || timeout <= 0 {
+		return locked, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Waiting up to %s for another podman-bootc process to release the VM\n", timeout)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	if mode == Exclusive {
+		locked, err = l.inner.TryLockContext(timeoutCtx, lockRetryDelay)
+	} else {
+		locked, err = l.inner.TryRLockContext(timeoutCtx, lockRetryDelay)
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return false, nil
+	}
+	return locked, err
+}
+
 // Unlock unlocks the cache lock.
 func (l CacheLock) Unlock() error {
 	return l.inner.Unlock()
@@ -7,16 +7,22 @@ import (
 	"fmt"
 	"github.com/containers/podman/v5/pkg/bindings/images"
 	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
+	buildahDefine "github.com/containers/buildah/define"
+	commonConfig "github.com/containers/common/pkg/config"
+	imageTypes "github.com/containers/image/v5/types"
 	"github.com/containers/podman/v5/pkg/bindings"
 	"github.com/containers/podman/v5/pkg/machine"
 	"github.com/containers/podman/v5/pkg/machine/define"
 	"github.com/containers/podman/v5/pkg/machine/env"
 	"github.com/containers/podman/v5/pkg/machine/provider"
 	"github.com/containers/podman/v5/pkg/machine/vmconfigs"
+	"github.com/containers/podman/v5/pkg/util"
 )
 
 type MachineContext struct {
@@ -30,10 +36,178 @@ type machineInfo struct {
 	rootful         bool
 }
 
+// PullOptions configures how an image is pulled into the podman machine
+type PullOptions struct {
+	// Policy is one of always, missing, never or newer, defaults to missing
+	Policy string
+	// AuthFile is the path to a registry authentication file on the host
+	AuthFile string
+	// Creds are the registry credentials as USERNAME[:PASSWORD]
+	Creds string
+	// TLSVerify requires HTTPS and verifies the registry certificates, when undefined
+	// the podman machine configuration is used
+	TLSVerify imageTypes.OptionalBool
+	// Arch selects the image variant to pull, e.g. aarch64, defaults to the host architecture
+	Arch string
+}
+
+// bindingsOptions converts the options to the podman bindings ones
+func (o PullOptions) bindingsOptions() (*images.PullOptions, error) {
+	policy := o.Policy
+	if policy == "" {
+		policy = "missing"
+	}
+	if _, err := commonConfig.ParsePullPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	options := new(images.PullOptions).WithPolicy(policy)
+	if o.AuthFile != "" {
+		if _, err := os.Stat(o.AuthFile); err != nil {
+			return nil, fmt.Errorf("checking authfile: %w", err)
+		}
+		options = options.WithAuthfile(o.AuthFile)
+	}
+
+	if o.Creds != "" {
+		creds, err := util.ParseRegistryCreds(o.Creds)
+		if err != nil {
+			return nil, err
+		}
+		options = options.WithUsername(creds.Username).WithPassword(creds.Password)
+	}
+
+	if o.TLSVerify != imageTypes.OptionalBoolUndefined {
+		options = options.WithSkipTLSVerify(o.TLSVerify == imageTypes.OptionalBoolFalse)
+	}
+
+	if o.Arch != "" {
+		ociArch, err := OCIArch(o.Arch)
+		if err != nil {
+			return nil, err
+		}
+		options = options.WithArch(ociArch)
+	}
+
+	return options, nil
+}
+
+// systemContext converts the registry options to the ones used by the podman bindings to build images
+func (o PullOptions) systemContext() (*imageTypes.SystemContext, error) {
+	sysCtx := &imageTypes.SystemContext{
+		AuthFilePath: o.AuthFile,
+	}
+
+	if o.Creds != "" {
+		creds, err := util.ParseRegistryCreds(o.Creds)
+		if err != nil {
+			return nil, err
+		}
+		sysCtx.DockerAuthConfig = creds
+	}
+
+	if o.TLSVerify == imageTypes.OptionalBoolFalse {
+		sysCtx.DockerInsecureSkipTLSVerify = imageTypes.OptionalBoolTrue
+	}
+
+	return sysCtx, nil
+}
+
+// buildPullPolicy converts the pull policy to the buildah one
+func (o PullOptions) buildPullPolicy() (buildahDefine.PullPolicy, error) {
+	policy, err := commonConfig.ParsePullPolicy(o.Policy)
+	if err != nil {
+		return buildahDefine.PullIfMissing, err
+	}
+
+	switch policy {
+	case commonConfig.PullPolicyAlways:
+		return buildahDefine.PullAlways, nil
+	case commonConfig.PullPolicyNewer:
+		return buildahDefine.PullIfNewer, nil
+	case commonConfig.PullPolicyNever:
+		return buildahDefine.PullNever, nil
+	default:
+		return buildahDefine.PullIfMissing, nil
+	}
+}
+
+// BuildOptions configures how an image is built in the podman machine
+type BuildOptions struct {
+	// ContextDir is the build context directory on the host
+	ContextDir string
+	// ContainerFile defaults to the Containerfile or Dockerfile in ContextDir
+	ContainerFile string
+	// Tag is the name given to the built image
+	Tag string
+	// Pull configures how the base images are pulled and the image architecture
+	Pull PullOptions
+	// Out receives the build output
+	Out io.Writer
+}
+
+// BuildImage builds an image in the podman machine, returning its ID
+func BuildImage(ctx context.Context, buildOptions BuildOptions) (string, error) {
+	containerFile := buildOptions.ContainerFile
+	if containerFile == "" {
+		for _, name := range []string{"Containerfile", "Dockerfile"} {
+			path := filepath.Join(buildOptions.ContextDir, name)
+			if exists, _ := FileExists(path); exists {
+				containerFile = path
+				break
+			}
+		}
+		if containerFile == "" {
+			return "", fmt.Errorf("no Containerfile or Dockerfile found in %s", buildOptions.ContextDir)
+		}
+	}
+
+	sysCtx, err := buildOptions.Pull.systemContext()
+	if err != nil {
+		return "", err
+	}
+
+	pullPolicy, err := buildOptions.Pull.buildPullPolicy()
+	if err != nil {
+		return "", err
+	}
+
+	options := types.BuildOptions{
+		BuildOptions: buildahDefine.BuildOptions{
+			ContextDirectory:       buildOptions.ContextDir,
+			Output:                 buildOptions.Tag,
+			Out:                    buildOptions.Out,
+			Err:                    buildOptions.Out,
+			PullPolicy:             pullPolicy,
+			SystemContext:          sysCtx,
+			Layers:                 true,
+			RemoveIntermediateCtrs: true,
+		},
+	}
+
+	if buildOptions.Pull.Arch != "" {
+		options.Architecture, err = OCIArch(buildOptions.Pull.Arch)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	report, err := images.Build(ctx, []string{containerFile}, options)
+	if err != nil {
+		return "", fmt.Errorf("failed to build image: %w", err)
+	}
+
+	return report.ID, nil
+}
+
 // PullAndInspect inpects the image, pulling in if the image if required
-func PullAndInspect(ctx context.Context, imageNameOrId string) (*types.ImageInspectReport, error) {
-	pullPolicy := "missing"
-	_, err := images.Pull(ctx, imageNameOrId, &images.PullOptions{Policy: &pullPolicy})
+func PullAndInspect(ctx context.Context, imageNameOrId string, pullOptions PullOptions) (*types.ImageInspectReport, error) {
+	options, err := pullOptions.bindingsOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pull options: %w", err)
+	}
+
+	_, err = images.Pull(ctx, imageNameOrId, options)
 	if err != nil {
 		return nil, fmt.Errorf("failed to pull image: %w", err)
 	}
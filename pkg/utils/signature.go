@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/image"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/podman/v5/pkg/domain/entities/types"
+	"github.com/sirupsen/logrus"
+)
+
+// VerifyOptions configures the verification of the image signatures
+type VerifyOptions struct {
+	// Verify enables the verification with the default policy, it is implied by PolicyPath
+	Verify bool
+	// PolicyPath is the path of a containers-policy.json(5) file on the host
+	PolicyPath string
+	// RegistriesDirPath is the path of a containers-registries.d(5) directory on the host,
+	// configuring where the signatures are stored
+	RegistriesDirPath string
+}
+
+// Enabled reports whether the image signatures must be verified
+func (o VerifyOptions) Enabled() bool {
+	return o.Verify || o.PolicyPath != ""
+}
+
+// VerifyImage checks the signatures of the registry image the podman machine image was
+// pulled from against the signature policy, and that the signed manifest references the
+// podman machine image, so the image that gets installed is the one that was verified.
+// It returns the verified reference, as repository@manifest-digest.
+func VerifyImage(ctx context.Context, imageData *types.ImageInspectReport, verifyOptions VerifyOptions, pullOptions PullOptions) (string, error) {
+	repoDigest, err := registryDigest(imageData)
+	if err != nil {
+		return "", err
+	}
+
+	named, err := reference.ParseNormalizedNamed(repoDigest)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", repoDigest, err)
+	}
+
+	ref, err := docker.NewReference(named)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", repoDigest, err)
+	}
+
+	sysCtx, err := pullOptions.systemContext()
+	if err != nil {
+		return "", err
+	}
+
+	if pullOptions.Arch != "" {
+		sysCtx.ArchitectureChoice, err = OCIArch(pullOptions.Arch)
+		if err != nil {
+			return "", err
+		}
+	}
+	sysCtx.RegistriesDirPath = verifyOptions.RegistriesDirPath
+
+	var policy *signature.Policy
+	if verifyOptions.PolicyPath != "" {
+		policy, err = signature.NewPolicyFromFile(verifyOptions.PolicyPath)
+	} else {
+		policy, err = signature.DefaultPolicy(sysCtx)
+	}
+	if err != nil {
+		return "", fmt.Errorf("loading signature policy: %w", err)
+	}
+
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return "", fmt.Errorf("loading signature policy: %w", err)
+	}
+	defer func() {
+		if err := policyContext.Destroy(); err != nil {
+			logrus.Debugf("destroying policy context: %v", err)
+		}
+	}()
+
+	logrus.Debugf("Verifying the signatures of %s", ref.DockerReference())
+	src, err := ref.NewImageSource(ctx, sysCtx)
+	if err != nil {
+		return "", fmt.Errorf("accessing %s: %w", repoDigest, err)
+	}
+	defer src.Close()
+
+	unparsed := image.UnparsedInstance(src, nil)
+	if _, err := policyContext.IsRunningImageAllowed(ctx, unparsed); err != nil {
+		return "", fmt.Errorf("image %s rejected by the signature policy: %w", repoDigest, err)
+	}
+
+	// The podman machine image must be the one referenced by the verified manifest,
+	// picking the instance of the podman machine architecture in a manifest list
+	img, err := image.FromUnparsedImage(ctx, sysCtx, unparsed)
+	if err != nil {
+		return "", fmt.Errorf("reading %s manifest: %w", repoDigest, err)
+	}
+
+	configDigest := img.ConfigInfo().Digest
+	if configDigest.Encoded() != imageData.ID {
+		return "", fmt.Errorf("verified image %s has the ID %s, but the podman machine image is %s", repoDigest, configDigest.Encoded(), imageData.ID)
+	}
+
+	return repoDigest, nil
+}
+
+// registryDigest returns the repository@digest reference of the registry image the
+// podman machine image was pulled from
+func registryDigest(imageData *types.ImageInspectReport) (string, error) {
+	if len(imageData.RepoDigests) == 0 {
+		return "", errors.New("the image was not pulled from a registry, its signature can't be verified")
+	}
+
+	for _, repoDigest := range imageData.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+imageData.Digest.String()) {
+			return repoDigest, nil
+		}
+	}
+
+	return imageData.RepoDigests[0], nil
+}
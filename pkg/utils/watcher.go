@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/sirupsen/logrus"
+)
+
+// Directories never watched, changing them doesn't change the built image
+var ignoredWatchDirs = map[string]bool{
+	".git": true,
+}
+
+// DirWatcher recursively watches a directory tree, reporting the changed
+// files in batches once no more changes happen during the debounce period
+type DirWatcher struct {
+	root     string
+	debounce time.Duration
+	inner    *fsnotify.Watcher
+	batches  chan []string
+	done     chan struct{}
+}
+
+// NewDirWatcher starts watching the root directory tree
+func NewDirWatcher(root string, debounce time.Duration) (*DirWatcher, error) {
+	inner, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("creating file watcher: %w", err)
+	}
+
+	w := &DirWatcher{
+		root:     root,
+		debounce: debounce,
+		inner:    inner,
+		batches:  make(chan []string),
+		done:     make(chan struct{}),
+	}
+
+	if err := w.addTree(root); err != nil {
+		inner.Close()
+		return nil, err
+	}
+
+	go w.run()
+	return w, nil
+}
+
+// Changes returns the channel receiving the batches of changed files, relative to the root
+func (w *DirWatcher) Changes() <-chan []string {
+	return w.batches
+}
+
+// Close stops watching
+func (w *DirWatcher) Close() error {
+	close(w.done)
+	return w.inner.Close()
+}
+
+func (w *DirWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the directory may be gone already
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		if ignoredWatchDirs[d.Name()] && path != w.root {
+			return filepath.SkipDir
+		}
+
+		if err := w.inner.Add(path); err != nil {
+			return fmt.Errorf("watching %s: %w", path, err)
+		}
+		return nil
+	})
+}
+
+func (w *DirWatcher) run() {
+	pending := map[string]bool{}
+	timer := time.NewTimer(w.debounce)
+	timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+
+		case event, ok := <-w.inner.Events:
+			if !ok {
+				return
+			}
+
+			// permission changes alone are not interesting
+			if event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			// new directories must be watched too
+			if event.Has(fsnotify.Create) {
+				if st, err := os.Stat(event.Name); err == nil && st.IsDir() {
+					if err := w.addTree(event.Name); err != nil {
+						logrus.Warnf("unable to watch %s: %v", event.Name, err)
+					}
+				}
+			}
+
+			rel, err := filepath.Rel(w.root, event.Name)
+			if err != nil {
+				rel = event.Name
+			}
+			logrus.Debugf("%s: %s", event.Op, rel)
+			pending[rel] = true
+			timer.Reset(w.debounce)
+
+		case err, ok := <-w.inner.Errors:
+			if !ok {
+				return
+			}
+			logrus.Warnf("file watcher error: %v", err)
+
+		case <-timer.C:
+			changed := make([]string, 0, len(pending))
+			for path := range pending {
+				changed = append(changed, path)
+			}
+			sort.Strings(changed)
+			pending = map[string]bool{}
+
+			select {
+			case w.batches <- changed:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package vm
+
+// GuestInfo is the information the qemu guest agent reports about the running guest
+type GuestInfo struct {
+	Hostname   string           `json:"Hostname,omitempty"`
+	OS         *GuestOS         `json:"OS,omitempty"`
+	Interfaces []GuestInterface `json:"Interfaces,omitempty"`
+}
+
+// GuestOS describes the operating system of the guest, from its os-release
+type GuestOS struct {
+	Name          string `json:"Name,omitempty"`
+	Version       string `json:"Version,omitempty"`
+	KernelRelease string `json:"KernelRelease,omitempty"`
+	Machine       string `json:"Machine,omitempty"`
+}
+
+// GuestInterface is a network interface of the guest, with its addresses in the
+// address/prefix form
+type GuestInterface struct {
+	Name         string   `json:"Name"`
+	HardwareAddr string   `json:"HardwareAddr,omitempty"`
+	Addresses    []string `json:"Addresses,omitempty"`
+}
@@ -0,0 +1,191 @@
+package vm
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"libvirt.org/go/libvirt"
+)
+
+// agentTimeout is how long to wait for the guest agent to answer a command, in seconds
+const agentTimeout = libvirt.DomainQemuAgentCommandTimeout(5)
+
+// agentExecInterval is the delay between two checks of a command run by the guest agent
+const agentExecInterval = 200 * time.Millisecond
+
+// errNoAgent is returned when the guest doesn't run the qemu guest agent
+var errNoAgent = errors.New("the qemu guest agent is not running in the VM, install qemu-guest-agent in the image")
+
+// agentCommand runs a guest agent command, unmarshalling its return value in result
+func (v *BootcVMLinux) agentCommand(execute string, arguments any, result any) error {
+	request := map[string]any{"execute": execute}
+	if arguments != nil {
+		request["arguments"] = arguments
+	}
+
+	command, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	out, err := v.domain.QemuAgentCommand(string(command), agentTimeout, 0)
+	if err != nil {
+		return agentError(err)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	var response struct {
+		Return json.RawMessage `json:"return"`
+	}
+	if err := json.Unmarshal([]byte(out), &response); err != nil {
+		return fmt.Errorf("invalid guest agent response to %s: %w", execute, err)
+	}
+	return json.Unmarshal(response.Return, result)
+}
+
+// agentError replaces the libvirt errors of a missing guest agent with errNoAgent
+func agentError(err error) error {
+	if errors.Is(err, libvirt.ERR_AGENT_UNRESPONSIVE) || errors.Is(err, libvirt.ERR_ARGUMENT_UNSUPPORTED) {
+		logrus.Debugf("guest agent: %v", err)
+		return errNoAgent
+	}
+	return err
+}
+
+// GuestInfo queries the guest agent for the guest host name, OS and network interfaces
+func (v *BootcVMLinux) GuestInfo() (*GuestInfo, error) {
+	if err := v.expectState(StateRunning); err != nil {
+		return nil, err
+	}
+
+	info, err := v.domain.GetGuestInfo(libvirt.DOMAIN_GUEST_INFO_OS|libvirt.DOMAIN_GUEST_INFO_HOSTNAME, 0)
+	if err != nil {
+		return nil, agentError(err)
+	}
+
+	guest := &GuestInfo{Hostname: info.Hostname}
+	if info.OS != nil {
+		guest.OS = &GuestOS{
+			Name:          info.OS.PrettyName,
+			Version:       info.OS.Version,
+			KernelRelease: info.OS.KernelRelease,
+			Machine:       info.OS.Machine,
+		}
+	}
+
+	interfaces, err := v.domain.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT)
+	if err != nil {
+		return nil, agentError(err)
+	}
+
+	for _, iface := range interfaces {
+		if iface.Name == "lo" {
+			continue
+		}
+
+		guestIface := GuestInterface{Name: iface.Name, HardwareAddr: iface.Hwaddr}
+		for _, addr := range iface.Addrs {
+			guestIface.Addresses = append(guestIface.Addresses, fmt.Sprintf("%s/%d", addr.Addr, addr.Prefix))
+		}
+		guest.Interfaces = append(guest.Interfaces, guestIface)
+	}
+
+	return guest, nil
+}
+
+// AgentExec runs a command in the guest through the guest agent, without SSH, and returns
+// its exit code once it exits. Its output is only written once it exits.
+func (v *BootcVMLinux) AgentExec(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
+	if len(args) == 0 {
+		return 0, errors.New("a command is required")
+	}
+
+	if err := v.expectState(StateRunning); err != nil {
+		return 0, err
+	}
+
+	var started struct {
+		Pid int `json:"pid"`
+	}
+	err := v.agentCommand("guest-exec", map[string]any{
+		"path":           args[0],
+		"arg":            args[1:],
+		"capture-output": true,
+	}, &started)
+	if err != nil {
+		return 0, fmt.Errorf("unable to run %s: %w", args[0], err)
+	}
+
+	for {
+		var status struct {
+			Exited   bool   `json:"exited"`
+			ExitCode int    `json:"exitcode"`
+			Signal   int    `json:"signal"`
+			OutData  string `json:"out-data"`
+			ErrData  string `json:"err-data"`
+		}
+		err := v.agentCommand("guest-exec-status", map[string]any{"pid": started.Pid}, &status)
+		if err != nil {
+			return 0, fmt.Errorf("unable to get the status of %s: %w", args[0], err)
+		}
+
+		if status.Exited {
+			if err := writeBase64(stdout, status.OutData); err != nil {
+				return 0, err
+			}
+			if err := writeBase64(stderr, status.ErrData); err != nil {
+				return 0, err
+			}
+
+			// the shell convention for the commands killed by a signal
+			if status.Signal != 0 {
+				return 128 + status.Signal, nil
+			}
+			return status.ExitCode, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(agentExecInterval):
+		}
+	}
+}
+
+func writeBase64(w io.Writer, data string) error {
+	if data == "" {
+		return nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return fmt.Errorf("invalid guest agent output: %w", err)
+	}
+	_, err = w.Write(decoded)
+	return err
+}
+
+// freezeFilesystems flushes and freezes the guest filesystems, so a disk snapshot is
+// consistent. It returns the function thawing them, a no-op when the guest doesn't run
+// the guest agent, the snapshot being only crash consistent then.
+func (v *BootcVMLinux) freezeFilesystems() func() {
+	if err := v.domain.FSFreeze(nil, 0); err != nil {
+		logrus.Warningf("unable to freeze the VM filesystems, the snapshot is only crash consistent: %v", agentError(err))
+		return func() {}
+	}
+
+	return func() {
+		if err := v.domain.FSThaw(nil, 0); err != nil {
+			logrus.Errorf("unable to thaw the VM filesystems: %v", agentError(err))
+		}
+	}
+}
@@ -0,0 +1,449 @@
+package vm
+
+import (
+	"archive/tar"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// sftpClient opens a SFTP session to the running VM, as the VM user. The session is
+// closed when ctx is cancelled, interrupting the transfers.
+func (v *BootcVMCommon) sftpClient(ctx context.Context) (*sftp.Client, func(), error) {
+	if err := v.loadSSHParams(); err != nil {
+		return nil, nil, err
+	}
+
+	config, err := v.sshClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", "localhost", v.sshPort), config)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, nil, fmt.Errorf("failed to start the SFTP session: %w", err)
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+	})
+
+	closeClient := func() {
+		stop()
+		sftpClient.Close()
+		client.Close()
+	}
+	return sftpClient, closeClient, nil
+}
+
+// copiedDir is a copied directory, its mode and modification time are set once its content
+// is copied, so a read-only directory can be filled and keeps its time
+type copiedDir struct {
+	path  string
+	mode  fs.FileMode
+	mtime time.Time
+}
+
+// setDirAttributes sets the attributes of the copied directories, the deepest ones first
+func setDirAttributes(dirs []copiedDir, chmod func(string, fs.FileMode) error, chtimes func(string, time.Time, time.Time) error) error {
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+		if err := chtimes(dirs[i].path, dirs[i].mtime, dirs[i].mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyDestination returns the path a source is copied to: into dst when it is an existing
+// directory, dst itself otherwise
+func copyDestination(src string, dst string, dstInfo fs.FileInfo, join func(...string) string) string {
+	if dstInfo != nil && dstInfo.IsDir() {
+		return join(dst, path.Base(filepath.ToSlash(src)))
+	}
+	return dst
+}
+
+// CopyToVM copies the local src file, or directory with recursive, to dst in the running
+// VM, preserving the file modes and modification times
+func (v *BootcVMCommon) CopyToVM(ctx context.Context, src string, dst string, recursive bool) error {
+	src = filepath.Clean(src)
+	client, closeClient, err := v.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if srcInfo.IsDir() && !recursive {
+		return fmt.Errorf("%s is a directory, use -r to copy it", src)
+	}
+
+	dstInfo, err := client.Stat(dst)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dst = copyDestination(src, dst, dstInfo, path.Join)
+
+	var dirs []copiedDir
+	err = filepath.WalkDir(src, func(localPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, localPath)
+		if err != nil {
+			return err
+		}
+		remotePath := path.Join(dst, filepath.ToSlash(rel))
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		logrus.Debugf("Copying %s to %s", localPath, remotePath)
+
+		switch {
+		case info.IsDir():
+			if err := client.Mkdir(remotePath); err != nil && !errors.Is(err, os.ErrExist) {
+				if dirInfo, statErr := client.Stat(remotePath); statErr != nil || !dirInfo.IsDir() {
+					return fmt.Errorf("unable to create %s: %w", remotePath, err)
+				}
+			}
+			dirs = append(dirs, copiedDir{remotePath, info.Mode().Perm(), info.ModTime()})
+			return nil
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(localPath)
+			if err != nil {
+				return err
+			}
+			_ = client.Remove(remotePath)
+			return client.Symlink(target, remotePath)
+		case info.Mode().IsRegular():
+			if err := copyFileToVM(client, localPath, remotePath); err != nil {
+				return err
+			}
+		default:
+			logrus.Warningf("skipping %s, only regular files, directories and symbolic links are copied", localPath)
+			return nil
+		}
+
+		if err := client.Chmod(remotePath, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return client.Chtimes(remotePath, info.ModTime(), info.ModTime())
+	})
+	if err != nil {
+		return err
+	}
+
+	return setDirAttributes(dirs, client.Chmod, client.Chtimes)
+}
+
+func copyFileToVM(client *sftp.Client, localPath string, remotePath string) error {
+	local, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	remote, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return fmt.Errorf("unable to create %s: %w", remotePath, err)
+	}
+	defer remote.Close()
+
+	if _, err := remote.ReadFrom(local); err != nil {
+		return fmt.Errorf("unable to write %s: %w", remotePath, err)
+	}
+	return remote.Close()
+}
+
+// CopyFromVM copies the src file, or directory with recursive, of the running VM to the
+// local dst, preserving the file modes and modification times
+func (v *BootcVMCommon) CopyFromVM(ctx context.Context, src string, dst string, recursive bool) error {
+	src = path.Clean(src)
+	client, closeClient, err := v.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	srcInfo, err := client.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+	if srcInfo.IsDir() && !recursive {
+		return fmt.Errorf("%s is a directory, use -r to copy it", src)
+	}
+
+	dstInfo, err := os.Stat(dst)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	dst = copyDestination(src, dst, dstInfo, filepath.Join)
+
+	var dirs []copiedDir
+	walker := client.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		remotePath, info := walker.Path(), walker.Stat()
+		rel := strings.TrimPrefix(strings.TrimPrefix(remotePath, src), "/")
+		localPath := filepath.Join(dst, filepath.FromSlash(rel))
+		logrus.Debugf("Copying %s to %s", remotePath, localPath)
+
+		switch {
+		case info.IsDir():
+			if err := os.Mkdir(localPath, 0700); err != nil && !errors.Is(err, os.ErrExist) {
+				return err
+			}
+			dirs = append(dirs, copiedDir{localPath, info.Mode().Perm(), info.ModTime()})
+			continue
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := client.ReadLink(remotePath)
+			if err != nil {
+				return err
+			}
+			_ = os.Remove(localPath)
+			if err := os.Symlink(target, localPath); err != nil {
+				return err
+			}
+			continue
+		case info.Mode().IsRegular():
+			if err := copyFileFromVM(client, remotePath, localPath); err != nil {
+				return err
+			}
+		default:
+			logrus.Warningf("skipping %s, only regular files, directories and symbolic links are copied", remotePath)
+			continue
+		}
+
+		if err := os.Chmod(localPath, info.Mode().Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(localPath, info.ModTime(), info.ModTime()); err != nil {
+			return err
+		}
+	}
+
+	return setDirAttributes(dirs, os.Chmod, os.Chtimes)
+}
+
+func copyFileFromVM(client *sftp.Client, remotePath string, localPath string) error {
+	remote, err := client.Open(remotePath)
+	if err != nil {
+		return fmt.Errorf("unable to open %s: %w", remotePath, err)
+	}
+	defer remote.Close()
+
+	local, err := os.OpenFile(localPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+
+	if _, err := remote.WriteTo(local); err != nil {
+		return fmt.Errorf("unable to read %s: %w", remotePath, err)
+	}
+	return local.Close()
+}
+
+// symlinkParent returns the parent of name that is one of the symbolic links, empty when
+// there is none
+func symlinkParent(name string, symlinks map[string]bool) string {
+	for dir := path.Dir(name); dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if symlinks[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// CopyTarToVM extracts the tar stream r in the dst directory of the running VM. The entries
+// under a symbolic link extracted before are refused, they would be written out of dst.
+func (v *BootcVMCommon) CopyTarToVM(ctx context.Context, r io.Reader, dst string) error {
+	client, closeClient, err := v.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	dstInfo, err := client.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("%s: %w", dst, err)
+	}
+	if !dstInfo.IsDir() {
+		return fmt.Errorf("%s is not a directory", dst)
+	}
+
+	var dirs []copiedDir
+	// the symbolic links extracted, by entry name
+	symlinks := map[string]bool{}
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return setDirAttributes(dirs, client.Chmod, client.Chtimes)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar stream: %w", err)
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// the entry names can't escape dst, neither through the symbolic links of the stream
+		name := path.Clean("/" + header.Name)
+		if link := symlinkParent(name, symlinks); link != "" {
+			return fmt.Errorf("refusing to extract %s through the symbolic link %s", header.Name, strings.TrimPrefix(link, "/"))
+		}
+		remotePath := path.Join(dst, name)
+		logrus.Debugf("Extracting %s to %s", header.Name, remotePath)
+
+		// an entry replacing a symbolic link is not written through it
+		if symlinks[name] {
+			if err := client.Remove(remotePath); err != nil {
+				return fmt.Errorf("unable to remove %s: %w", remotePath, err)
+			}
+			delete(symlinks, name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := client.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("unable to create %s: %w", remotePath, err)
+			}
+			dirs = append(dirs, copiedDir{remotePath, header.FileInfo().Mode().Perm(), header.ModTime})
+			continue
+		case tar.TypeSymlink:
+			_ = client.Remove(remotePath)
+			if err := client.Symlink(header.Linkname, remotePath); err != nil {
+				return err
+			}
+			symlinks[name] = true
+			continue
+		case tar.TypeReg:
+			if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+				return fmt.Errorf("unable to create %s: %w", path.Dir(remotePath), err)
+			}
+			remote, err := client.OpenFile(remotePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+			if err != nil {
+				return fmt.Errorf("unable to create %s: %w", remotePath, err)
+			}
+			_, err = remote.ReadFrom(tr)
+			remote.Close()
+			if err != nil {
+				return fmt.Errorf("unable to write %s: %w", remotePath, err)
+			}
+		default:
+			logrus.Warningf("skipping %s, only regular files, directories and symbolic links are copied", header.Name)
+			continue
+		}
+
+		if err := client.Chmod(remotePath, header.FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+		if err := client.Chtimes(remotePath, header.ModTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+}
+
+// CopyTarFromVM writes the src file or directory of the running VM to w as a tar stream,
+// whose entries are prefixed with the src base name
+func (v *BootcVMCommon) CopyTarFromVM(ctx context.Context, w io.Writer, src string) error {
+	src = path.Clean(src)
+	client, closeClient, err := v.sftpClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeClient()
+
+	if _, err := client.Lstat(src); err != nil {
+		return fmt.Errorf("%s: %w", src, err)
+	}
+
+	tw := tar.NewWriter(w)
+	base := path.Base(src)
+	walker := client.Walk(src)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		remotePath, info := walker.Path(), walker.Stat()
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			link, err = client.ReadLink(remotePath)
+			if err != nil {
+				return err
+			}
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			logrus.Warningf("skipping %s, only regular files, directories and symbolic links are copied", remotePath)
+			continue
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(base, strings.TrimPrefix(strings.TrimPrefix(remotePath, src), "/"))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		// the owner is the one of the VM, the names don't match the host ones
+		header.Uname, header.Gname = "", ""
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if info.Mode().IsRegular() {
+			remote, err := client.Open(remotePath)
+			if err != nil {
+				return fmt.Errorf("unable to open %s: %w", remotePath, err)
+			}
+			_, err = remote.WriteTo(tw)
+			remote.Close()
+			if err != nil {
+				return fmt.Errorf("unable to read %s: %w", remotePath, err)
+			}
+		}
+	}
+
+	return tw.Close()
+}
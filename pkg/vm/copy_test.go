@@ -0,0 +1,61 @@
+//go:build linux
+
+package vm
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("copyDestination", func() {
+	var dir, file fs.FileInfo
+
+	BeforeEach(func() {
+		tmpDir := GinkgoT().TempDir()
+		var err error
+		dir, err = os.Stat(tmpDir)
+		Expect(err).To(Not(HaveOccurred()))
+
+		Expect(os.WriteFile(filepath.Join(tmpDir, "file"), nil, 0600)).To(Succeed())
+		file, err = os.Stat(filepath.Join(tmpDir, "file"))
+		Expect(err).To(Not(HaveOccurred()))
+	})
+
+	It("should copy into an existing directory", func() {
+		Expect(copyDestination("/etc/hosts", "/tmp", dir, path.Join)).To(Equal("/tmp/hosts"))
+		Expect(copyDestination("dir/sub/", "/tmp", dir, path.Join)).To(Equal("/tmp/sub"))
+		Expect(copyDestination("hosts", ".", dir, path.Join)).To(Equal("hosts"))
+	})
+
+	It("should copy to the destination path otherwise", func() {
+		Expect(copyDestination("/etc/hosts", "/tmp/hosts.copy", nil, path.Join)).To(Equal("/tmp/hosts.copy"))
+		Expect(copyDestination("/etc/hosts", "/tmp/file", file, path.Join)).To(Equal("/tmp/file"))
+	})
+
+	It("should use the base name of a local source with the local separator", func() {
+		src := filepath.Join("dir", "sub", "file")
+		Expect(copyDestination(src, "/home/user", dir, path.Join)).To(Equal("/home/user/file"))
+	})
+})
+
+var _ = Describe("symlinkParent", func() {
+	symlinks := map[string]bool{"/link": true, "/dir/link": true}
+
+	DescribeTable("should find the symbolic link parent of an entry",
+		func(name string, expected string) {
+			Expect(symlinkParent(name, symlinks)).To(Equal(expected))
+		},
+		Entry("under a link", "/link/passwd", "/link"),
+		Entry("deep under a link", "/link/a/b/c", "/link"),
+		Entry("under a nested link", "/dir/link/file", "/dir/link"),
+		Entry("the link itself", "/link", ""),
+		Entry("next to a link", "/dir/file", ""),
+		Entry("with a link name prefix", "/linked/file", ""),
+		Entry("at the top", "/file", ""),
+	)
+})
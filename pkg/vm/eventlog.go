@@ -0,0 +1,403 @@
+package vm
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// EventLog is a TCG PC Client measured boot event log
+type EventLog struct {
+	// Algorithm is the digest algorithm of the reported digests and PCR values,
+	// sha256 when the log has it, sha1 otherwise
+	Algorithm string
+	Events    []Event
+	// PCRs are the values of the PCRs computed by replaying the events
+	PCRs map[uint32]string
+}
+
+// Event is a measurement of the event log
+type Event struct {
+	PCR    uint32
+	Type   string
+	Digest string
+	// Description is the readable part of the event data, if any
+	Description string `json:",omitempty"`
+}
+
+// TCG algorithm IDs of the supported digest algorithms
+const (
+	algSHA1   uint16 = 0x0004
+	algSHA256 uint16 = 0x000b
+)
+
+const (
+	evNoAction                 uint32 = 0x00000003
+	evEFIVariableDriverConfig  uint32 = 0x80000001
+	evEFIVariableBoot          uint32 = 0x80000002
+	evEFIPlatformFirmwareBlob2 uint32 = 0x8000000a
+	evEFIVariableBoot2         uint32 = 0x8000000c
+	evEFIVariableAuthority     uint32 = 0x800000e0
+)
+
+var eventTypes = map[uint32]string{
+	0x00000000:                 "EV_PREBOOT_CERT",
+	0x00000001:                 "EV_POST_CODE",
+	0x00000002:                 "EV_UNUSED",
+	evNoAction:                 "EV_NO_ACTION",
+	0x00000004:                 "EV_SEPARATOR",
+	0x00000005:                 "EV_ACTION",
+	0x00000006:                 "EV_EVENT_TAG",
+	0x00000007:                 "EV_S_CRTM_CONTENTS",
+	0x00000008:                 "EV_S_CRTM_VERSION",
+	0x00000009:                 "EV_CPU_MICROCODE",
+	0x0000000a:                 "EV_PLATFORM_CONFIG_FLAGS",
+	0x0000000b:                 "EV_TABLE_OF_DEVICES",
+	0x0000000c:                 "EV_COMPACT_HASH",
+	0x0000000d:                 "EV_IPL",
+	0x0000000e:                 "EV_IPL_PARTITION_DATA",
+	0x0000000f:                 "EV_NONHOST_CODE",
+	0x00000010:                 "EV_NONHOST_CONFIG",
+	0x00000011:                 "EV_NONHOST_INFO",
+	0x00000012:                 "EV_OMIT_BOOT_DEVICE_EVENTS",
+	evEFIVariableDriverConfig:  "EV_EFI_VARIABLE_DRIVER_CONFIG",
+	evEFIVariableBoot:          "EV_EFI_VARIABLE_BOOT",
+	0x80000003:                 "EV_EFI_BOOT_SERVICES_APPLICATION",
+	0x80000004:                 "EV_EFI_BOOT_SERVICES_DRIVER",
+	0x80000005:                 "EV_EFI_RUNTIME_SERVICES_DRIVER",
+	0x80000006:                 "EV_EFI_GPT_EVENT",
+	0x80000007:                 "EV_EFI_ACTION",
+	0x80000008:                 "EV_EFI_PLATFORM_FIRMWARE_BLOB",
+	0x80000009:                 "EV_EFI_HANDOFF_TABLES",
+	evEFIPlatformFirmwareBlob2: "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+	0x8000000b:                 "EV_EFI_HANDOFF_TABLES2",
+	evEFIVariableBoot2:         "EV_EFI_VARIABLE_BOOT2",
+	0x80000010:                 "EV_EFI_HCRTM_EVENT",
+	evEFIVariableAuthority:     "EV_EFI_VARIABLE_AUTHORITY",
+	0x800000e1:                 "EV_EFI_SPDM_FIRMWARE_BLOB",
+	0x800000e2:                 "EV_EFI_SPDM_FIRMWARE_CONFIG",
+}
+
+// The first event of a crypto agile log (TPM 2.0) describes the digest algorithms
+var specIDSignature = []byte("Spec ID Event03\x00")
+
+// The event setting the initial value of PCR 0 to the locality the firmware started from
+var startupLocalitySignature = []byte("StartupLocality\x00")
+
+type digestAlgorithm struct {
+	id   uint16
+	size uint16
+}
+
+type rawEvent struct {
+	pcr       uint32
+	eventType uint32
+	digests   map[uint16][]byte
+	data      []byte
+}
+
+// ParseEventLog parses a binary TCG PC Client event log, in the SHA1 format of
+// TPM 1.2 or the crypto agile format of TPM 2.0, and replays it
+func ParseEventLog(data []byte) (*EventLog, error) {
+	r := bytes.NewReader(data)
+
+	// The first event is always in the SHA1 format
+	first, err := readSHA1Event(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the first event: %w", err)
+	}
+
+	rawEvents := []*rawEvent{first}
+	algorithms, cryptoAgile, err := parseSpecIDEvent(first)
+	if err != nil {
+		return nil, err
+	}
+	if cryptoAgile {
+		rawEvents = nil
+	}
+
+	for r.Len() > 0 {
+		var event *rawEvent
+		if cryptoAgile {
+			event, err = readCryptoAgileEvent(r, algorithms)
+		} else {
+			event, err = readSHA1Event(r)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading event %d: %w", len(rawEvents)+1, err)
+		}
+		rawEvents = append(rawEvents, event)
+	}
+
+	return replayEvents(rawEvents)
+}
+
+func replayEvents(rawEvents []*rawEvent) (*EventLog, error) {
+	algorithm, name, newHash := algSHA256, "sha256", sha256.New
+	for _, event := range rawEvents {
+		if _, ok := event.digests[algSHA256]; !ok {
+			algorithm, name, newHash = algSHA1, "sha1", sha1.New
+			break
+		}
+	}
+
+	eventLog := &EventLog{
+		Algorithm: name,
+		Events:    make([]Event, 0, len(rawEvents)),
+		PCRs:      map[uint32]string{},
+	}
+
+	pcrs := map[uint32][]byte{}
+	for _, event := range rawEvents {
+		digest, ok := event.digests[algorithm]
+		if !ok {
+			return nil, fmt.Errorf("event of PCR %d has no %s digest", event.pcr, name)
+		}
+
+		eventLog.Events = append(eventLog.Events, Event{
+			PCR:         event.pcr,
+			Type:        eventTypeName(event.eventType),
+			Digest:      hex.EncodeToString(digest),
+			Description: describeEvent(event.eventType, event.data),
+		})
+
+		// EV_NO_ACTION events are informative, they are not extended into the PCRs
+		if event.eventType == evNoAction {
+			if locality, ok := startupLocality(event.data); ok && event.pcr == 0 {
+				pcr0 := make([]byte, newHash().Size())
+				pcr0[len(pcr0)-1] = locality
+				pcrs[0] = pcr0
+			}
+			continue
+		}
+
+		pcr, ok := pcrs[event.pcr]
+		if !ok {
+			pcr = make([]byte, newHash().Size())
+		}
+		pcrs[event.pcr] = extend(newHash(), pcr, digest)
+	}
+
+	for index, value := range pcrs {
+		eventLog.PCRs[index] = hex.EncodeToString(value)
+	}
+
+	return eventLog, nil
+}
+
+func extend(h hash.Hash, pcr, digest []byte) []byte {
+	h.Write(pcr)
+	h.Write(digest)
+	return h.Sum(nil)
+}
+
+func readSHA1Event(r *bytes.Reader) (*rawEvent, error) {
+	var header struct {
+		PCR       uint32
+		EventType uint32
+		Digest    [sha1.Size]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	data, err := readEventData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rawEvent{
+		pcr:       header.PCR,
+		eventType: header.EventType,
+		digests:   map[uint16][]byte{algSHA1: header.Digest[:]},
+		data:      data,
+	}, nil
+}
+
+func readCryptoAgileEvent(r *bytes.Reader, algorithms []digestAlgorithm) (*rawEvent, error) {
+	var header struct {
+		PCR       uint32
+		EventType uint32
+		Count     uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	event := &rawEvent{
+		pcr:       header.PCR,
+		eventType: header.EventType,
+		digests:   map[uint16][]byte{},
+	}
+
+	for i := uint32(0); i < header.Count; i++ {
+		var id uint16
+		if err := binary.Read(r, binary.LittleEndian, &id); err != nil {
+			return nil, err
+		}
+
+		size, err := digestSize(algorithms, id)
+		if err != nil {
+			return nil, err
+		}
+
+		digest := make([]byte, size)
+		if _, err := io.ReadFull(r, digest); err != nil {
+			return nil, err
+		}
+		event.digests[id] = digest
+	}
+
+	var err error
+	event.data, err = readEventData(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return event, nil
+}
+
+func readEventData(r *bytes.Reader) ([]byte, error) {
+	var size uint32
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return nil, err
+	}
+
+	if int64(size) > int64(r.Len()) {
+		return nil, fmt.Errorf("event data size %d exceeds the log size", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func digestSize(algorithms []digestAlgorithm, id uint16) (uint16, error) {
+	for _, algorithm := range algorithms {
+		if algorithm.id == id {
+			return algorithm.size, nil
+		}
+	}
+	return 0, fmt.Errorf("digest algorithm 0x%04x is not declared by the log", id)
+}
+
+// parseSpecIDEvent returns the digest algorithms of a crypto agile log, and false
+// if the log is in the SHA1 format
+func parseSpecIDEvent(event *rawEvent) ([]digestAlgorithm, bool, error) {
+	if event.eventType != evNoAction || !bytes.HasPrefix(event.data, specIDSignature) {
+		return nil, false, nil
+	}
+
+	// The signature is followed by the platform class, the spec version and errata,
+	// the UINTN size, then the algorithms
+	if len(event.data) < len(specIDSignature)+8 {
+		return nil, false, errors.New("invalid Spec ID event: truncated")
+	}
+	r := bytes.NewReader(event.data[len(specIDSignature)+8:])
+	var count uint32
+	if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+		return nil, false, fmt.Errorf("reading the Spec ID event: %w", err)
+	}
+
+	if int64(count)*4 > int64(r.Len()) {
+		return nil, false, errors.New("invalid Spec ID event: too many digest algorithms")
+	}
+
+	algorithms := make([]digestAlgorithm, count)
+	for i := range algorithms {
+		if err := binary.Read(r, binary.LittleEndian, &algorithms[i].id); err != nil {
+			return nil, false, fmt.Errorf("reading the Spec ID event: %w", err)
+		}
+		if err := binary.Read(r, binary.LittleEndian, &algorithms[i].size); err != nil {
+			return nil, false, fmt.Errorf("reading the Spec ID event: %w", err)
+		}
+	}
+
+	return algorithms, true, nil
+}
+
+func startupLocality(data []byte) (byte, bool) {
+	if !bytes.HasPrefix(data, startupLocalitySignature) || len(data) <= len(startupLocalitySignature) {
+		return 0, false
+	}
+	return data[len(startupLocalitySignature)], true
+}
+
+func eventTypeName(eventType uint32) string {
+	if name, ok := eventTypes[eventType]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", eventType)
+}
+
+// describeEvent returns the readable part of the event data: the variable name of the
+// UEFI variable events, the firmware blob description, or the data when it is text
+func describeEvent(eventType uint32, data []byte) string {
+	switch eventType {
+	case evEFIVariableDriverConfig, evEFIVariableBoot, evEFIVariableBoot2, evEFIVariableAuthority:
+		// UEFI_VARIABLE_DATA: the variable GUID, the name length in characters,
+		// the data length, then the UTF-16 name
+		if len(data) < 32 {
+			return ""
+		}
+		nameLength := binary.LittleEndian.Uint64(data[16:24])
+		if nameLength > uint64(len(data)-32)/2 {
+			return ""
+		}
+		return decodeUTF16(data[32 : 32+2*nameLength])
+	case evEFIPlatformFirmwareBlob2:
+		// UEFI_PLATFORM_FIRMWARE_BLOB2: the description length, then the description
+		if len(data) == 0 || int(data[0]) >= len(data) {
+			return ""
+		}
+		return printableText(data[1 : 1+data[0]])
+	}
+
+	if text := printableText(data); text != "" {
+		return text
+	}
+	if len(data)%2 == 0 {
+		if text := decodeUTF16(data); isPrintable(text) {
+			return text
+		}
+	}
+	return ""
+}
+
+func decodeUTF16(data []byte) string {
+	chars := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		chars = append(chars, binary.LittleEndian.Uint16(data[i:]))
+	}
+	return strings.TrimRight(string(utf16.Decode(chars)), "\x00")
+}
+
+func printableText(data []byte) string {
+	text := strings.TrimRight(string(data), "\x00")
+	if !isPrintable(text) {
+		return ""
+	}
+	return text
+}
+
+func isPrintable(text string) bool {
+	if text == "" {
+		return false
+	}
+	for _, c := range text {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
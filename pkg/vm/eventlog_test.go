@@ -0,0 +1,245 @@
+//go:build linux
+
+package vm_test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"unicode/utf16"
+
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const (
+	testEvNoAction                        = 0x00000003
+	testEvSeparator                       = 0x00000004
+	testEvSCRTMVersion                    = 0x00000008
+	testEvEFIVariableDriverConfig         = 0x80000001
+	testEvEFIPlatformFirmwareBlob2        = 0x8000000a
+	testAlgSHA1                    uint16 = 0x0004
+	testAlgSHA256                  uint16 = 0x000b
+)
+
+// logWriter builds binary TCG event logs
+type logWriter struct {
+	bytes.Buffer
+}
+
+func (w *logWriter) put(values ...any) *logWriter {
+	for _, v := range values {
+		_ = binary.Write(&w.Buffer, binary.LittleEndian, v)
+	}
+	return w
+}
+
+// sha1Event appends an event in the SHA1 format of TPM 1.2 logs
+func (w *logWriter) sha1Event(pcr, eventType uint32, digest []byte, data []byte) *logWriter {
+	w.put(pcr, eventType)
+	w.Write(digest)
+	return w.put(uint32(len(data))).put(data)
+}
+
+// agileEvent appends an event in the crypto agile format, with the digests of the
+// algorithms in order
+func (w *logWriter) agileEvent(pcr, eventType uint32, digests map[uint16][]byte, data []byte) *logWriter {
+	w.put(pcr, eventType, uint32(len(digests)))
+	for _, id := range []uint16{testAlgSHA1, testAlgSHA256} {
+		if digest, ok := digests[id]; ok {
+			w.put(id)
+			w.Write(digest)
+		}
+	}
+	return w.put(uint32(len(data))).put(data)
+}
+
+// specIDEvent appends the first event of a crypto agile log, declaring SHA1 and SHA256
+func (w *logWriter) specIDEvent() *logWriter {
+	var data logWriter
+	data.WriteString("Spec ID Event03\x00")
+	// platform class, spec version minor, major, errata, UINTN size
+	data.put(uint32(0), uint8(0), uint8(2), uint8(0), uint8(2))
+	data.put(uint32(2), testAlgSHA1, uint16(sha1.Size), testAlgSHA256, uint16(sha256.Size))
+	data.put(uint8(0))
+	return w.sha1Event(0, testEvNoAction, make([]byte, sha1.Size), data.Bytes())
+}
+
+func sha1Digest(data string) []byte {
+	sum := sha1.Sum([]byte(data))
+	return sum[:]
+}
+
+func sha256Digest(data string) []byte {
+	sum := sha256.Sum256([]byte(data))
+	return sum[:]
+}
+
+// replay extends the digests in turn into a PCR starting at initial, with the hash
+// algorithm of the PCR size
+func replay(initial []byte, digests ...[]byte) string {
+	pcr := initial
+	for _, digest := range digests {
+		data := append(append([]byte{}, pcr...), digest...)
+		if len(pcr) == sha1.Size {
+			sum := sha1.Sum(data)
+			pcr = sum[:]
+		} else {
+			sum := sha256.Sum256(data)
+			pcr = sum[:]
+		}
+	}
+	return hex.EncodeToString(pcr)
+}
+
+// uefiVariableData returns an UEFI_VARIABLE_DATA structure without variable data
+func uefiVariableData(name string) []byte {
+	var w logWriter
+	w.Write(make([]byte, 16))
+	chars := utf16.Encode([]rune(name))
+	w.put(uint64(len(chars)), uint64(0), chars)
+	return w.Bytes()
+}
+
+var _ = Describe("ParseEventLog", func() {
+	It("should replay a SHA1 log", func() {
+		crtm := sha1Digest("crtm")
+		secureBoot := sha1Digest("secureboot")
+		separator := sha1Digest("separator")
+
+		var log logWriter
+		log.sha1Event(0, testEvSCRTMVersion, crtm, []byte("1.0\x00"))
+		log.sha1Event(7, testEvEFIVariableDriverConfig, secureBoot, uefiVariableData("SecureBoot"))
+		log.sha1Event(0, testEvSeparator, separator, []byte{0, 0, 0, 0})
+
+		eventLog, err := vm.ParseEventLog(log.Bytes())
+		Expect(err).To(Not(HaveOccurred()))
+
+		Expect(eventLog.Algorithm).To(Equal("sha1"))
+		Expect(eventLog.Events).To(Equal([]vm.Event{
+			{PCR: 0, Type: "EV_S_CRTM_VERSION", Digest: hex.EncodeToString(crtm), Description: "1.0"},
+			{PCR: 7, Type: "EV_EFI_VARIABLE_DRIVER_CONFIG", Digest: hex.EncodeToString(secureBoot), Description: "SecureBoot"},
+			{PCR: 0, Type: "EV_SEPARATOR", Digest: hex.EncodeToString(separator)},
+		}))
+
+		zero := make([]byte, sha1.Size)
+		Expect(eventLog.PCRs).To(Equal(map[uint32]string{
+			0: replay(zero, crtm, separator),
+			7: replay(zero, secureBoot),
+		}))
+	})
+
+	It("should replay a crypto agile log with the SHA256 digests", func() {
+		blob := map[uint16][]byte{testAlgSHA1: sha1Digest("dxe"), testAlgSHA256: sha256Digest("dxe")}
+		var blobData logWriter
+		blobData.put(uint8(5)).WriteString("DXEFV")
+		blobData.put(uint64(0), uint64(0))
+
+		var locality logWriter
+		locality.WriteString("StartupLocality\x00")
+		locality.put(uint8(3))
+
+		var log logWriter
+		log.specIDEvent()
+		log.agileEvent(0, testEvNoAction, map[uint16][]byte{testAlgSHA1: make([]byte, sha1.Size), testAlgSHA256: make([]byte, sha256.Size)}, locality.Bytes())
+		log.agileEvent(0, testEvEFIPlatformFirmwareBlob2, blob, blobData.Bytes())
+
+		eventLog, err := vm.ParseEventLog(log.Bytes())
+		Expect(err).To(Not(HaveOccurred()))
+
+		Expect(eventLog.Algorithm).To(Equal("sha256"))
+		// the Spec ID event only describes the log
+		Expect(eventLog.Events).To(HaveLen(2))
+		Expect(eventLog.Events[0].Type).To(Equal("EV_NO_ACTION"))
+		Expect(eventLog.Events[1]).To(Equal(vm.Event{
+			PCR:         0,
+			Type:        "EV_EFI_PLATFORM_FIRMWARE_BLOB2",
+			Digest:      hex.EncodeToString(blob[testAlgSHA256]),
+			Description: "DXEFV",
+		}))
+
+		// the startup locality sets the initial value of PCR 0
+		initial := make([]byte, sha256.Size)
+		initial[len(initial)-1] = 3
+		Expect(eventLog.PCRs).To(Equal(map[uint32]string{
+			0: replay(initial, blob[testAlgSHA256]),
+		}))
+	})
+
+	It("should fall back to SHA1 when an event has no SHA256 digest", func() {
+		digest := sha1Digest("event")
+
+		var log logWriter
+		log.specIDEvent()
+		log.agileEvent(4, 0x0000000d, map[uint16][]byte{testAlgSHA1: digest}, []byte("grub\x00"))
+
+		eventLog, err := vm.ParseEventLog(log.Bytes())
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(eventLog.Algorithm).To(Equal("sha1"))
+		Expect(eventLog.Events).To(Equal([]vm.Event{
+			{PCR: 4, Type: "EV_IPL", Digest: hex.EncodeToString(digest), Description: "grub"},
+		}))
+		Expect(eventLog.PCRs).To(Equal(map[uint32]string{
+			4: replay(make([]byte, sha1.Size), digest),
+		}))
+	})
+
+	It("should name the unknown event types by their value", func() {
+		var log logWriter
+		log.sha1Event(8, 0x12345678, sha1Digest("unknown"), nil)
+
+		eventLog, err := vm.ParseEventLog(log.Bytes())
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(eventLog.Events[0].Type).To(Equal("0x12345678"))
+	})
+
+	DescribeTable("should fail on an invalid log",
+		func(log func() []byte, message string) {
+			_, err := vm.ParseEventLog(log())
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("empty", func() []byte {
+			return nil
+		}, "reading the first event"),
+		Entry("truncated in the first event header", func() []byte {
+			var log logWriter
+			log.sha1Event(0, testEvSeparator, sha1Digest("separator"), nil)
+			return log.Bytes()[:10]
+		}, "reading the first event"),
+		Entry("truncated in the event data", func() []byte {
+			var log logWriter
+			log.sha1Event(0, testEvSeparator, sha1Digest("separator"), nil)
+			log.sha1Event(1, testEvSeparator, sha1Digest("separator"), []byte("data"))
+			return log.Bytes()[:log.Len()-2]
+		}, "event data size 4 exceeds the log size"),
+		Entry("truncated in a crypto agile digest", func() []byte {
+			var log logWriter
+			log.specIDEvent()
+			log.agileEvent(0, testEvSeparator, map[uint16][]byte{testAlgSHA1: sha1Digest("a"), testAlgSHA256: sha256Digest("a")}, nil)
+			return log.Bytes()[:log.Len()-20]
+		}, "reading event 1"),
+		Entry("undeclared digest algorithm", func() []byte {
+			var log logWriter
+			log.specIDEvent()
+			log.put(uint32(0), uint32(testEvSeparator), uint32(1), uint16(0x000c))
+			return log.Bytes()
+		}, "digest algorithm 0x000c is not declared by the log"),
+		Entry("truncated Spec ID event", func() []byte {
+			var log logWriter
+			log.sha1Event(0, testEvNoAction, make([]byte, sha1.Size), []byte("Spec ID Event03\x00\x00"))
+			return log.Bytes()
+		}, "invalid Spec ID event: truncated"),
+		Entry("Spec ID event with too many algorithms", func() []byte {
+			var data logWriter
+			data.WriteString("Spec ID Event03\x00")
+			data.put(uint32(0), uint32(0), uint32(1000))
+			var log logWriter
+			log.sha1Event(0, testEvNoAction, make([]byte, sha1.Size), data.Bytes())
+			return log.Bytes()
+		}, "too many digest algorithms"),
+	)
+})
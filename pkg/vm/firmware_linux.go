@@ -0,0 +1,106 @@
+package vm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"libvirt.org/go/libvirt"
+)
+
+// secureBootOwnerGUID identifies podman-bootc as the owner of the enrolled keys
+const secureBootOwnerGUID = "4f2b9d1e-6c3a-4e85-b7d0-2a9e5c1f8b36"
+
+// secureBootKeys are the certificates expected in the enrolled keys directory,
+// with the virt-fw-vars option enrolling them
+var secureBootKeys = []struct {
+	file   string
+	option string
+}{
+	{"PK.crt", "--set-pk"},
+	{"KEK.crt", "--add-kek"},
+	{"db.crt", "--add-db"},
+}
+
+// nvramPath returns the path of the UEFI variables store of the VM. There is one per
+// firmware type, each one being created from a different template.
+func (v *BootcVMLinux) nvramPath() string {
+	name := "nvram-" + v.firmware
+	if v.enrollKeysDir != "" {
+		name += "-custom"
+	}
+	return filepath.Join(v.cacheDir, name)
+}
+
+// enrollSecureBootKeys creates the UEFI variables store from the firmware template with the
+// keys of the enrolled keys directory, unless it is more recent than the keys
+func (v *BootcVMLinux) enrollSecureBootKeys() error {
+	nvram := v.nvramPath()
+	nvramInfo, err := os.Stat(nvram)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	upToDate := err == nil
+
+	args := []string{"--secure-boot"}
+	for _, key := range secureBootKeys {
+		keyPath := filepath.Join(v.enrollKeysDir, key.file)
+		keyInfo, err := os.Stat(keyPath)
+		if err != nil {
+			return fmt.Errorf("missing Secure Boot key: %w", err)
+		}
+
+		if upToDate && keyInfo.ModTime().After(nvramInfo.ModTime()) {
+			upToDate = false
+		}
+		args = append(args, key.option, secureBootOwnerGUID, keyPath)
+	}
+
+	if upToDate {
+		logrus.Debugf("Secure Boot keys already enrolled in %s", nvram)
+		return nil
+	}
+
+	template, err := v.nvramTemplate()
+	if err != nil {
+		return err
+	}
+
+	args = append([]string{"--input", template, "--output", nvram}, args...)
+	cmd := exec.Command("virt-fw-vars", args...)
+	logrus.Debugf("Executing: %v", cmd.Args)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("virt-fw-vars failed: %w: %s", err, out)
+	}
+
+	return nil
+}
+
+// nvramTemplate returns the UEFI variables store template of the firmware selected by libvirt
+func (v *BootcVMLinux) nvramTemplate() (string, error) {
+	domainXML, err := v.domain.GetXMLDesc(libvirt.DOMAIN_XML_INACTIVE)
+	if err != nil {
+		return "", fmt.Errorf("unable to get the domain XML: %w", err)
+	}
+
+	var domain struct {
+		OS struct {
+			NVRAM struct {
+				Template string `xml:"template,attr"`
+			} `xml:"nvram"`
+		} `xml:"os"`
+	}
+	if err := xml.Unmarshal([]byte(domainXML), &domain); err != nil {
+		return "", fmt.Errorf("unable to parse the domain XML: %w", err)
+	}
+
+	if domain.OS.NVRAM.Template == "" {
+		return "", errors.New("libvirt did not select a firmware template, libvirt 9.2 or later is required")
+	}
+
+	return domain.OS.NVRAM.Template, nil
+}
@@ -0,0 +1,139 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/containers/podman-bootc/pkg/events"
+
+	"github.com/sirupsen/logrus"
+	"libvirt.org/go/libvirt"
+)
+
+var startEventLoop sync.Once
+
+// LifecycleReportedLive is set when WatchLifecycle reports the lifecycle events
+const LifecycleReportedLive = true
+
+// WatchLifecycle reports the lifecycle events of the podman-bootc libvirt domains until
+// ctx is done. report is called from the libvirt event loop goroutine.
+func WatchLifecycle(ctx context.Context, libvirtUri string, report func(events.Event)) error {
+	var loopErr error
+	startEventLoop.Do(func() {
+		// the event loop must be registered before opening the connection
+		if loopErr = libvirt.EventRegisterDefaultImpl(); loopErr != nil {
+			return
+		}
+		go func() {
+			for {
+				if err := libvirt.EventRunDefaultImpl(); err != nil {
+					logrus.Warningf("libvirt event loop: %v", err)
+				}
+			}
+		}()
+	})
+	if loopErr != nil {
+		return fmt.Errorf("unable to start the libvirt event loop: %w", loopErr)
+	}
+
+	conn, err := libvirt.NewConnect(libvirtUri)
+	if err != nil {
+		return fmt.Errorf("unable to connect to libvirt: %w", err)
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	var closeOnce sync.Once
+	if err := conn.RegisterCloseCallback(func(_ *libvirt.Connect, _ libvirt.ConnectCloseReason) {
+		closeOnce.Do(func() { close(closed) })
+	}); err != nil {
+		return fmt.Errorf("unable to watch the libvirt connection: %w", err)
+	}
+	defer func() {
+		_ = conn.UnregisterCloseCallback()
+	}()
+
+	domainId := func(domain *libvirt.Domain) (string, bool) {
+		name, err := domain.GetName()
+		if err != nil {
+			return "", false
+		}
+		return strings.CutPrefix(name, domainPrefix)
+	}
+
+	lifecycleId, err := conn.DomainEventLifecycleRegister(nil, func(_ *libvirt.Connect, domain *libvirt.Domain, event *libvirt.DomainEventLifecycle) {
+		id, ok := domainId(domain)
+		if !ok {
+			return
+		}
+		if status, detail, ok := lifecycleStatus(event); ok {
+			report(events.New(id, status, detail))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("unable to watch the libvirt domains: %w", err)
+	}
+	defer func() {
+		_ = conn.DomainEventDeregister(lifecycleId)
+	}()
+
+	rebootId, err := conn.DomainEventRebootRegister(nil, func(_ *libvirt.Connect, domain *libvirt.Domain) {
+		if id, ok := domainId(domain); ok {
+			report(events.New(id, events.Reboot, ""))
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("unable to watch the libvirt domains: %w", err)
+	}
+	defer func() {
+		_ = conn.DomainEventDeregister(rebootId)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-closed:
+		return errors.New("the libvirt connection was closed")
+	}
+}
+
+// lifecycleStatus maps a libvirt lifecycle event to an event status, the events
+// not changing whether the VM runs are ignored
+func lifecycleStatus(event *libvirt.DomainEventLifecycle) (status string, detail string, ok bool) {
+	switch event.Event {
+	case libvirt.DOMAIN_EVENT_STARTED:
+		switch libvirt.DomainEventStartedDetailType(event.Detail) {
+		case libvirt.DOMAIN_EVENT_STARTED_RESTORED:
+			detail = "restored"
+		case libvirt.DOMAIN_EVENT_STARTED_FROM_SNAPSHOT:
+			detail = "snapshot"
+		}
+		return events.Start, detail, true
+	case libvirt.DOMAIN_EVENT_STOPPED:
+		switch libvirt.DomainEventStoppedDetailType(event.Detail) {
+		case libvirt.DOMAIN_EVENT_STOPPED_CRASHED:
+			return events.Crash, "", true
+		case libvirt.DOMAIN_EVENT_STOPPED_FAILED:
+			return events.Crash, "failed", true
+		case libvirt.DOMAIN_EVENT_STOPPED_SHUTDOWN:
+			detail = "shutdown"
+		case libvirt.DOMAIN_EVENT_STOPPED_DESTROYED:
+			detail = "destroyed"
+		case libvirt.DOMAIN_EVENT_STOPPED_SAVED:
+			detail = "saved"
+		case libvirt.DOMAIN_EVENT_STOPPED_FROM_SNAPSHOT:
+			detail = "snapshot"
+		}
+		return events.Stop, detail, true
+	case libvirt.DOMAIN_EVENT_SUSPENDED:
+		return events.Pause, "", true
+	case libvirt.DOMAIN_EVENT_RESUMED:
+		return events.Unpause, "", true
+	case libvirt.DOMAIN_EVENT_CRASHED:
+		return events.Crash, "", true
+	}
+	return "", "", false
+}
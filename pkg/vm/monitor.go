@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/events"
+	"github.com/containers/podman-bootc/pkg/user"
+	"github.com/containers/podman-bootc/pkg/utils"
 
 	"github.com/sirupsen/logrus"
 )
@@ -15,13 +19,20 @@ type stopFunction func() error
 type waitFunction func() error
 
 type MonitorParmeters struct {
+	User        user.User
+	ImageID     string
 	CacheDir    string
 	RunDir      string
 	Username    string
 	SshIdentity string
 	SshPort     int
+	Restart     string
 }
 
+// restartDelay is the delay before relaunching a VM that stopped, so a VM failing to
+// boot doesn't spin
+const restartDelay = 5 * time.Second
+
 func StartMonitor(ctx context.Context, params MonitorParmeters) error {
 	netSocket, stopGvpd, err := startNetworkDaemon(ctx, params.RunDir, params.SshPort)
 	if err != nil {
@@ -33,16 +44,52 @@ func StartMonitor(ctx context.Context, params MonitorParmeters) error {
 		}
 	}()
 
-	krkWait, err := startKrunkit(ctx, params.CacheDir, params.Username, params.SshIdentity, netSocket)
-	if err != nil {
-		return err
-	}
+	for relaunch := false; ; relaunch = true {
+		krkWait, err := startKrunkit(ctx, params.CacheDir, params.Username, params.SshIdentity, netSocket)
+		if err != nil {
+			return err
+		}
+		// the first start is recorded by run
+		if relaunch {
+			events.Record(params.User, params.ImageID, events.Start, "")
+		}
+
+		krkErr := krkWait()
+		if krkErr != nil {
+			logrus.Debugf("krunkit wait return error: %v", krkErr)
+		}
+
+		// the VM is stopped by cancelling ctx, krunkit exits on its own when the
+		// guest powers off or crashes
+		if ctx.Err() != nil {
+			return nil
+		}
+		if krkErr != nil {
+			events.Record(params.User, params.ImageID, events.Crash, "")
+		} else {
+			events.Record(params.User, params.ImageID, events.Stop, "shutdown")
+		}
+
+		if !shouldRestart(params.Restart, krkErr) {
+			return nil
+		}
 
-	if err := krkWait(); err != nil {
-		logrus.Debugf("krunkit wait return error: %v", err)
+		logrus.Infof("VM stopped, restarting it in %s", restartDelay)
+		if err := utils.SleepWithContext(ctx, restartDelay); err != nil {
+			return nil
+		}
 	}
+}
 
-	return nil
+// shouldRestart tells whether the restart policy relaunches a VM that exited with exitErr
+func shouldRestart(restart string, exitErr error) bool {
+	switch restart {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exitErr != nil
+	}
+	return false
 }
 
 func startNetworkDaemon(ctx context.Context, runDir string, sshPort int) (string, stopFunction, error) {
@@ -80,7 +127,12 @@ func startKrunkit(ctx context.Context, cacheDir, username, sshIdentity, netSocke
 	pidFile := filepath.Join(cacheDir, config.RunPidFile)
 	disk := filepath.Join(cacheDir, config.DiskImage)
 
-	oemString, err := oemStringSystemdCredential(username, sshIdentity)
+	hostKey, err := sshHostKey(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	oemString, err := oemStringSystemdCredential(username, sshIdentity, hostKey)
 	if err != nil {
 		return nil, fmt.Errorf("creating oemstring systemd credential %w", err)
 	}
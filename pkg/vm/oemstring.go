@@ -2,13 +2,16 @@ package vm
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+
+	"github.com/containers/podman-bootc/pkg/config"
 )
 
-func oemStringSystemdCredential(username, sshIdentity string) (string, error) {
-	tmpFilesCmd, err := tmpFileSshKey(username, sshIdentity)
+func oemStringSystemdCredential(username, sshIdentity, hostKey string) (string, error) {
+	tmpFilesCmd, err := tmpFileSshKey(username, sshIdentity, hostKey)
 	if err != nil {
 		return "", err
 	}
@@ -16,7 +19,14 @@ func oemStringSystemdCredential(username, sshIdentity string) (string, error) {
 	return oemString, nil
 }
 
-func tmpFileSshKey(username, sshIdentity string) (string, error) {
+// sshHostKeyCredential is the credential of the SSH host key, passed from the file of the VM
+// cache dir
+const sshHostKeyCredential = "podman-bootc.ssh-host-key"
+
+// tmpFileSshKey returns the tmpfiles entries installing the SSH key of the user, and the SSH
+// host key when there is one. The private host key is copied from its credential, only the
+// public one is inline.
+func tmpFileSshKey(username, sshIdentity, hostKey string) (string, error) {
 	pubKey, err := os.ReadFile(sshIdentity + ".pub")
 	if err != nil {
 		return "", err
@@ -30,6 +40,35 @@ func tmpFileSshKey(username, sshIdentity string) (string, error) {
 
 	tmpFileCmd := fmt.Sprintf("d %[1]s/.ssh 0750 %[2]s %[2]s -\nf+~ %[1]s/.ssh/authorized_keys 700 %[2]s %[2]s - %[3]s", userHomeDir, username, pubKeyEnc)
 
+	if hostKey != "" {
+		pubHostKey, err := os.ReadFile(hostKey + ".pub")
+		if err != nil {
+			return "", err
+		}
+
+		// sshd-keygen doesn't generate the host keys that already exist, PID 1 imports the
+		// system credentials in /run/credentials/@system
+		tmpFileCmd += fmt.Sprintf("\nC+ /etc/ssh/%[1]s 0600 root root - /run/credentials/@system/%[2]s\nf+~ /etc/ssh/%[1]s.pub 0644 root root - %[3]s",
+			config.SshHostKeyFile, sshHostKeyCredential, base64.StdEncoding.EncodeToString(pubHostKey))
+	}
+
 	tmpFileCmdEnc := base64.StdEncoding.EncodeToString([]byte(tmpFileCmd))
 	return tmpFileCmdEnc, nil
 }
+
+// sshHostKey returns the path of the SSH host key in the VM cache dir, empty for the VMs
+// created by older versions, which don't have one, and when it isn't injected
+func sshHostKey(cacheDir string) (string, error) {
+	if !SSHHostKeyInjected {
+		return "", nil
+	}
+
+	hostKey := filepath.Join(cacheDir, config.SshHostKeyFile)
+	if _, err := os.Stat(hostKey + ".pub"); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+		return "", err
+	}
+	return hostKey, nil
+}
@@ -0,0 +1,310 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/events"
+	"github.com/containers/podman-bootc/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Readiness probes, all but ssh and vsock are checked over SSH, or over vsock when the
+// VM has the vsock shell
+const (
+	ProbeSSH     = "ssh"     // the SSH server accepts the VM key
+	ProbeVsock   = "vsock"   // the vsock shell accepts commands
+	ProbeSystemd = "systemd" // systemd finished booting the system
+	ProbeUnit    = "unit"    // a systemd unit is active
+	ProbePort    = "port"    // a TCP port of the VM accepts connections
+	ProbeCmd     = "cmd"     // a shell command succeeds
+)
+
+// probeInterval is the delay between two checks of a probe
+const probeInterval = 500 * time.Millisecond
+
+// ReadinessProbe is a condition the VM is ready once it is met
+type ReadinessProbe struct {
+	Kind string
+	// Arg is the unit, port or command of the unit, port and cmd probes
+	Arg string
+}
+
+// errProbeFailed reports a probe that will never succeed, e.g. a failed unit
+var errProbeFailed = errors.New("readiness probe failed")
+
+// ParseReadinessProbe parses ssh, vsock, systemd, unit=<name>, port=<n> or cmd=<script>
+func ParseReadinessProbe(probe string) (ReadinessProbe, error) {
+	kind, arg, hasArg := strings.Cut(probe, "=")
+	switch kind {
+	case ProbeSSH, ProbeVsock, ProbeSystemd:
+		if hasArg {
+			return ReadinessProbe{}, fmt.Errorf("invalid readiness probe %q, %s takes no value", probe, kind)
+		}
+	case ProbeUnit, ProbeCmd:
+		if arg == "" {
+			return ReadinessProbe{}, fmt.Errorf("invalid readiness probe %q, %s=<value> is required", probe, kind)
+		}
+	case ProbePort:
+		port, err := strconv.Atoi(arg)
+		if err != nil || port < 1 || port > 65535 {
+			return ReadinessProbe{}, fmt.Errorf("invalid readiness probe %q, the port must be between 1 and 65535", probe)
+		}
+	default:
+		return ReadinessProbe{}, fmt.Errorf("invalid readiness probe %q, use ssh, vsock, systemd, unit=<name>, port=<n> or cmd=<script>", probe)
+	}
+
+	return ReadinessProbe{Kind: kind, Arg: arg}, nil
+}
+
+func (p ReadinessProbe) String() string {
+	if p.Arg == "" {
+		return p.Kind
+	}
+	return p.Kind + "=" + p.Arg
+}
+
+// DefaultReadyTimeout returns how long a VM of the architecture is expected to take to boot
+func DefaultReadyTimeout(arch string) time.Duration {
+	// Emulated VMs boot an order of magnitude slower
+	if arch != "" && arch != utils.HostArch() {
+		return 10 * time.Minute
+	}
+	return 1 * time.Minute
+}
+
+// WaitForSSHToBeReady polls the VM until a SSH connection succeeds, the timeout
+// expires or ctx is cancelled
+func (v *BootcVMCommon) WaitForSSHToBeReady(ctx context.Context) error {
+	return v.WaitForReady(ctx, nil, 0)
+}
+
+// WaitForReady polls the VM until the SSH server accepts the VM key, or the vsock shell
+// accepts commands when the VM has it, then until each probe succeeds in turn. It fails
+// once the timeout expires, the default one with a zero timeout, or when ctx is cancelled.
+func (v *BootcVMCommon) WaitForReady(ctx context.Context, probes []ReadinessProbe, timeout time.Duration) error {
+	// a VM loaded by ID only knows its SSH parameters from its config
+	if v.sshPort == 0 {
+		if err := v.loadSSHParams(); err != nil {
+			return err
+		}
+	}
+
+	if timeout == 0 {
+		timeout = DefaultReadyTimeout(v.arch)
+	}
+	deadline := time.Now().Add(timeout)
+	probeCtx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+
+	config, err := v.sshClientConfig()
+	if err != nil {
+		return err
+	}
+
+	transport := ReadinessProbe{Kind: ProbeSSH}
+	if v.vsock {
+		transport.Kind = ProbeVsock
+	}
+
+	probes = append([]ReadinessProbe{transport}, probes...)
+	for i, probe := range probes {
+		// the transport probe given explicitly is already checked
+		if i > 0 && probe.Kind == transport.Kind {
+			continue
+		}
+		if probe.Kind == ProbeVsock && !v.vsock {
+			return errors.New("the vsock probe requires a VM run with --vsock")
+		}
+
+		logrus.Debugf("Waiting for the %s readiness probe", probe)
+		for {
+			ready, err := v.checkProbe(probeCtx, config, probe)
+			if err != nil {
+				return fmt.Errorf("%s: %w", probe, err)
+			}
+			if ready {
+				break
+			}
+
+			if err := utils.SleepWithContext(probeCtx, probeInterval); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("VM not ready after %s, waiting for %s", timeout, probe)
+			}
+		}
+
+		if probe.Kind == ProbeSSH {
+			events.Record(v.user, v.imageID, events.SSHReady, "")
+		}
+	}
+
+	return nil
+}
+
+// probeConn runs the probe commands in the VM
+type probeConn interface {
+	// output runs a command, returning its trimmed combined output
+	output(command string) (string, error)
+	// dialPort checks a TCP port of the VM accepts connections
+	dialPort(port string) error
+	Close() error
+}
+
+// sshProbeConn runs the probe commands over SSH
+type sshProbeConn struct {
+	client *ssh.Client
+	stop   func() bool
+}
+
+// vsockProbeConn runs the probe commands over vsock, each in a new connection
+type vsockProbeConn struct {
+	ctx context.Context
+	vm  *BootcVMCommon
+}
+
+// dialProbe connects to the VM to check a probe, over SSH for the ssh probe and the VMs
+// without the vsock shell
+func (v *BootcVMCommon) dialProbe(ctx context.Context, config *ssh.ClientConfig, probe ReadinessProbe) (probeConn, error) {
+	if v.vsock && probe.Kind != ProbeSSH {
+		conn := &vsockProbeConn{ctx: ctx, vm: v}
+		// the shell answers once the socket unit listens
+		if _, err := conn.output("true"); err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", "localhost", v.sshPort), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+
+	// the commands may block, e.g. until the boot finishes
+	stop := context.AfterFunc(ctx, func() {
+		client.Close()
+	})
+	return &sshProbeConn{client: client, stop: stop}, nil
+}
+
+func (c *sshProbeConn) output(command string) (string, error) {
+	return probeOutput(c.client, command)
+}
+
+func (c *sshProbeConn) dialPort(port string) error {
+	conn, err := c.client.Dial("tcp", "localhost:"+port)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+func (c *sshProbeConn) Close() error {
+	c.stop()
+	return c.client.Close()
+}
+
+func (c *vsockProbeConn) output(command string) (string, error) {
+	out, exitCode, err := c.vm.vsockCommandOutput(c.ctx, command)
+	if err == nil && exitCode != 0 {
+		err = &utils.ExitCodeError{Code: exitCode}
+	}
+	return strings.TrimSpace(string(out)), err
+}
+
+func (c *vsockProbeConn) dialPort(port string) error {
+	// the bash /dev/tcp redirections connect to a port
+	out, err := c.output("bash -c " + shellQuote("exec 3<>/dev/tcp/localhost/"+port))
+	if err != nil {
+		return fmt.Errorf("%w: %s", err, out)
+	}
+	return nil
+}
+
+func (c *vsockProbeConn) Close() error {
+	return nil
+}
+
+// checkProbe checks a probe once, only failing when it will never succeed
+func (v *BootcVMCommon) checkProbe(ctx context.Context, config *ssh.ClientConfig, probe ReadinessProbe) (bool, error) {
+	conn, err := v.dialProbe(ctx, config, probe)
+	if err != nil {
+		logrus.Debugf("failed to connect to the VM: %s", err)
+		return false, nil
+	}
+	defer conn.Close()
+
+	switch probe.Kind {
+	case ProbeSSH, ProbeVsock:
+		return true, nil
+
+	case ProbeSystemd:
+		// it waits for the boot to finish, and fails unless the system is running
+		state, _ := conn.output("systemctl is-system-running --wait")
+		switch state {
+		case "running":
+			return true, nil
+		case "degraded":
+			failed, _ := conn.output("systemctl --failed --plain --no-legend")
+			return false, fmt.Errorf("%w: the system is degraded:\n%s", errProbeFailed, failed)
+		}
+		logrus.Debugf("system state: %s", state)
+		return false, nil
+
+	case ProbeUnit:
+		state, _ := conn.output("systemctl is-active " + shellQuote(probe.Arg))
+		switch state {
+		case "active":
+			return true, nil
+		case "failed":
+			return false, fmt.Errorf("%w: the unit failed", errProbeFailed)
+		}
+		logrus.Debugf("unit %s state: %s", probe.Arg, state)
+		return false, nil
+
+	case ProbePort:
+		if err := conn.dialPort(probe.Arg); err != nil {
+			logrus.Debugf("failed to connect to port %s: %s", probe.Arg, err)
+			return false, nil
+		}
+		return true, nil
+
+	case ProbeCmd:
+		out, err := conn.output(probe.Arg)
+		if err != nil {
+			logrus.Debugf("readiness command failed: %s: %s", err, out)
+			return false, nil
+		}
+		return true, nil
+	}
+
+	return false, fmt.Errorf("unknown readiness probe %s", probe.Kind)
+}
+
+// probeOutput runs a command in a new session, returning its trimmed combined output
+func probeOutput(client *ssh.Client, command string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var out bytes.Buffer
+	session.Stdout = &out
+	session.Stderr = &out
+	err = session.Run(command)
+	return strings.TrimSpace(out.String()), err
+}
+
+// shellQuote quotes a word for the POSIX shell running the SSH commands
+func shellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
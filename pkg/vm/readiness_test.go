@@ -0,0 +1,48 @@
+//go:build linux
+
+package vm_test
+
+import (
+	"github.com/containers/podman-bootc/pkg/vm"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseReadinessProbe", func() {
+	DescribeTable("should parse the probe",
+		func(probe string, expected vm.ReadinessProbe) {
+			parsed, err := vm.ParseReadinessProbe(probe)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(parsed).To(Equal(expected))
+			Expect(parsed.String()).To(Equal(probe))
+		},
+		Entry("ssh", "ssh", vm.ReadinessProbe{Kind: vm.ProbeSSH}),
+		Entry("vsock", "vsock", vm.ReadinessProbe{Kind: vm.ProbeVsock}),
+		Entry("systemd", "systemd", vm.ReadinessProbe{Kind: vm.ProbeSystemd}),
+		Entry("unit", "unit=httpd.service", vm.ReadinessProbe{Kind: vm.ProbeUnit, Arg: "httpd.service"}),
+		Entry("lowest port", "port=1", vm.ReadinessProbe{Kind: vm.ProbePort, Arg: "1"}),
+		Entry("highest port", "port=65535", vm.ReadinessProbe{Kind: vm.ProbePort, Arg: "65535"}),
+		Entry("cmd with an equal sign", "cmd=test -f /run/ready=1", vm.ReadinessProbe{Kind: vm.ProbeCmd, Arg: "test -f /run/ready=1"}),
+	)
+
+	DescribeTable("should fail on an invalid probe",
+		func(probe string, message string) {
+			_, err := vm.ParseReadinessProbe(probe)
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+		Entry("empty", "", "use ssh, vsock, systemd"),
+		Entry("unknown kind", "http=80", "use ssh, vsock, systemd"),
+		Entry("uppercase kind", "SSH", "use ssh, vsock, systemd"),
+		Entry("ssh with a value", "ssh=22", "ssh takes no value"),
+		Entry("systemd with an empty value", "systemd=", "systemd takes no value"),
+		Entry("unit without a value", "unit", "unit=<value> is required"),
+		Entry("unit with an empty value", "unit=", "unit=<value> is required"),
+		Entry("cmd without a value", "cmd", "cmd=<value> is required"),
+		Entry("port without a value", "port", "the port must be between 1 and 65535"),
+		Entry("port zero", "port=0", "the port must be between 1 and 65535"),
+		Entry("port too high", "port=65536", "the port must be between 1 and 65535"),
+		Entry("negative port", "port=-1", "the port must be between 1 and 65535"),
+		Entry("port name", "port=http", "the port must be between 1 and 65535"),
+	)
+})
@@ -0,0 +1,238 @@
+package vm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Snapshot states, the state of the VM when the snapshot was created
+const (
+	SnapshotRunning = "running"
+	SnapshotShutoff = "shutoff"
+)
+
+// snapshotsFile records the snapshots and the disk layers of a VM, in its snapshots dir
+const snapshotsFile = "snapshots.json"
+
+var snapshotNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Snapshot is a saved state of a VM, it can be reverted to
+type Snapshot struct {
+	Name    string
+	Created time.Time
+	State   string
+	// Disk is the qcow2 layer, or the disk image, frozen by the snapshot
+	Disk string
+	// Memory is the memory state of a running VM snapshot
+	Memory string `json:",omitempty"`
+	// SshPort is the port forwarded to the SSH server of a running VM snapshot
+	SshPort int `json:",omitempty"`
+}
+
+// snapshotState is the disk layout of a VM. The VM runs on a qcow2 overlay, the active
+// layer, created on top of the base layer when the VM starts and discarded when it stops.
+// Creating a snapshot of a running VM freezes the active layer and creates a new one on top
+// of it, while a snapshot of a stopped VM freezes the base layer. Reverting to a snapshot
+// makes its layer the base layer.
+type snapshotState struct {
+	Snapshots []Snapshot
+	// Base is the layer the VM boots from, the disk image when empty
+	Base string `json:",omitempty"`
+	// Active is the layer the running VM writes to
+	Active string `json:",omitempty"`
+	// Backing maps each qcow2 layer to the layer it is created on top of
+	Backing map[string]string
+	// DiskImage identifies the disk image the layers are created on top of, the layers
+	// are stale once it is reinstalled
+	DiskImage string `json:",omitempty"`
+}
+
+// ValidateSnapshotName checks the snapshot name can be used as a file name
+func ValidateSnapshotName(name string) error {
+	if !snapshotNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid snapshot name %q, only letters, digits, '_', '.' and '-' are allowed", name)
+	}
+	return nil
+}
+
+func (v *BootcVMCommon) snapshotsDir() string {
+	return filepath.Join(v.cacheDir, config.SnapshotsDir)
+}
+
+// ListSnapshots returns the snapshots of the VM, oldest first
+func (v *BootcVMCommon) ListSnapshots() ([]Snapshot, error) {
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return nil, err
+	}
+	return state.Snapshots, nil
+}
+
+// CurrentSnapshot returns the name of the snapshot the VM was last reverted to,
+// empty if it runs from the disk image
+func (v *BootcVMCommon) CurrentSnapshot() (string, error) {
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return "", err
+	}
+
+	for _, snapshot := range state.Snapshots {
+		if snapshot.Disk == state.Base {
+			return snapshot.Name, nil
+		}
+	}
+	return "", nil
+}
+
+// DeleteSnapshot removes the named snapshot, and its layers no other snapshot depends on
+func (v *BootcVMCommon) DeleteSnapshot(name string) error {
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return err
+	}
+
+	i := state.findSnapshot(name)
+	if i < 0 {
+		return fmt.Errorf("snapshot %s not found", name)
+	}
+	state.Snapshots = append(state.Snapshots[:i], state.Snapshots[i+1:]...)
+
+	if err := v.removeUnusedLayers(state); err != nil {
+		return err
+	}
+	return v.saveSnapshotState(state)
+}
+
+func (v *BootcVMCommon) loadSnapshotState() (*snapshotState, error) {
+	state := &snapshotState{Backing: map[string]string{}}
+
+	content, err := os.ReadFile(filepath.Join(v.snapshotsDir(), snapshotsFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return state, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, state); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", snapshotsFile, err)
+	}
+	if state.Backing == nil {
+		state.Backing = map[string]string{}
+	}
+
+	return state, nil
+}
+
+func (v *BootcVMCommon) saveSnapshotState(state *snapshotState) error {
+	if err := os.MkdirAll(v.snapshotsDir(), 0700); err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	// replace the file atomically, a truncated state would lose track of the layers
+	path := filepath.Join(v.snapshotsDir(), snapshotsFile)
+	if err := os.WriteFile(path+".tmp", content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// findSnapshot returns the index of the named snapshot, -1 if there is none
+func (s *snapshotState) findSnapshot(name string) int {
+	for i, snapshot := range s.Snapshots {
+		if snapshot.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// baseDisk returns the layer the VM boots from
+func (s *snapshotState) baseDisk(diskImagePath string) string {
+	if s.Base == "" {
+		return diskImagePath
+	}
+	return s.Base
+}
+
+// setActive makes the VM write to the active layer, created on top of the backing layer
+func (s *snapshotState) setActive(active, backing string) {
+	s.Backing[active] = backing
+	s.Active = active
+}
+
+// removeUnusedLayers removes the layers and the memory states no snapshot, nor the base
+// and active layers, depend on
+func (v *BootcVMCommon) removeUnusedLayers(state *snapshotState) error {
+	used := map[string]bool{}
+	markChain := func(layer string) {
+		for layer != "" && !used[layer] {
+			used[layer] = true
+			layer = state.Backing[layer]
+		}
+	}
+
+	markChain(state.Base)
+	markChain(state.Active)
+	for _, snapshot := range state.Snapshots {
+		markChain(snapshot.Disk)
+		used[snapshot.Memory] = true
+	}
+
+	entries, err := os.ReadDir(v.snapshotsDir())
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(v.snapshotsDir(), entry.Name())
+		if entry.Name() == snapshotsFile || used[path] {
+			continue
+		}
+
+		logrus.Debugf("Removing unused snapshot file %s", path)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(state.Backing, path)
+	}
+
+	for layer := range state.Backing {
+		if !used[layer] {
+			delete(state.Backing, layer)
+		}
+	}
+
+	return nil
+}
+
+// newLayerPath returns a unique path for a qcow2 layer
+func (v *BootcVMCommon) newLayerPath() string {
+	return filepath.Join(v.snapshotsDir(), fmt.Sprintf("layer-%d.qcow2", time.Now().UnixNano()))
+}
+
+// diskFormat returns the format of a layer, the disk image is raw
+func diskFormat(layer string) string {
+	if strings.HasSuffix(layer, ".qcow2") {
+		return "qcow2"
+	}
+	return "raw"
+}
@@ -0,0 +1,284 @@
+package vm
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/events"
+
+	"github.com/sirupsen/logrus"
+	"libvirt.org/go/libvirt"
+)
+
+// CreateSnapshot saves the state of the VM: its disk and memory when it is running,
+// the disk it boots from when it is stopped. With diskOnly, only the disk of a running
+// VM is saved, once the guest agent flushed and froze its filesystems.
+func (v *BootcVMLinux) CreateSnapshot(name string, diskOnly bool) (*Snapshot, error) {
+	if err := ValidateSnapshotName(name); err != nil {
+		return nil, err
+	}
+
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return nil, err
+	}
+
+	if state.findSnapshot(name) >= 0 {
+		return nil, fmt.Errorf("snapshot %s already exists", name)
+	}
+
+	if err := v.checkDiskImage(state); err != nil {
+		return nil, err
+	}
+
+	isRunning, err := v.IsRunning()
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := Snapshot{
+		Name:    name,
+		Created: time.Now(),
+		State:   SnapshotShutoff,
+		Disk:    state.baseDisk(v.diskImagePath),
+	}
+
+	if isRunning {
+		if state.Active == "" {
+			return nil, errors.New("the VM was started by an older podman-bootc without snapshot support, restart it first")
+		}
+
+		cfg, err := v.LoadConfigFile()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load VM config: %w", err)
+		}
+
+		// The active layer is frozen, and the VM goes on writing to a new layer on top of it
+		snapshot.State = SnapshotRunning
+		snapshot.Disk = state.Active
+		active := v.newLayerPath()
+
+		// The snapshots are tracked by podman-bootc, the domain is redefined on each run
+		flags := libvirt.DOMAIN_SNAPSHOT_CREATE_NO_METADATA | libvirt.DOMAIN_SNAPSHOT_CREATE_ATOMIC
+		memoryXML := `<memory snapshot="no"/>`
+		if diskOnly {
+			flags |= libvirt.DOMAIN_SNAPSHOT_CREATE_DISK_ONLY
+			// A memory snapshot captures the guest page cache, a disk-only one needs
+			// the filesystems to be flushed to be consistent
+			thaw := v.freezeFilesystems()
+			defer thaw()
+		} else {
+			snapshot.Memory = filepath.Join(v.snapshotsDir(), name+".mem")
+			snapshot.SshPort = cfg.SshPort
+			memoryXML = fmt.Sprintf(`<memory snapshot="external" file="%s"/>`, xmlEscape(snapshot.Memory))
+		}
+
+		snapshotXML := fmt.Sprintf(`<domainsnapshot>
+  <name>%s</name>
+  %s
+  <disks>
+    <disk name="vda" snapshot="external" type="file">
+      <driver type="qcow2"/>
+      <source file="%s"/>
+    </disk>
+  </disks>
+</domainsnapshot>`, xmlEscape(name), memoryXML, xmlEscape(active))
+
+		domainSnapshot, err := v.domain.CreateSnapshotXML(snapshotXML, flags)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create the snapshot: %w", err)
+		}
+		if err := domainSnapshot.Free(); err != nil {
+			logrus.Debugf("unable to free the snapshot: %v", err)
+		}
+
+		state.setActive(active, state.Active)
+	}
+
+	state.Snapshots = append(state.Snapshots, snapshot)
+	if err := v.saveSnapshotState(state); err != nil {
+		return nil, err
+	}
+
+	return &snapshot, nil
+}
+
+// RevertSnapshot discards the current state of the VM and reverts it to the named snapshot.
+// The VM is running after reverting to a snapshot with the memory of a running VM, stopped
+// otherwise, and boots from the snapshot disk the next time it is started.
+func (v *BootcVMLinux) RevertSnapshot(name string) (err error) {
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return err
+	}
+
+	i := state.findSnapshot(name)
+	if i < 0 {
+		return fmt.Errorf("snapshot %s not found", name)
+	}
+	snapshot := state.Snapshots[i]
+
+	if err := v.Delete(); err != nil {
+		return err
+	}
+
+	// Delete discarded the active layer
+	state, err = v.loadSnapshotState()
+	if err != nil {
+		return err
+	}
+	state.Base = snapshot.Disk
+
+	if snapshot.Memory == "" {
+		if err := v.removeUnusedLayers(state); err != nil {
+			return err
+		}
+		return v.saveSnapshotState(state)
+	}
+
+	active := v.newLayerPath()
+	if err := createOverlay(snapshot.Disk, active); err != nil {
+		return err
+	}
+	state.setActive(active, snapshot.Disk)
+	if err := v.removeUnusedLayers(state); err != nil {
+		return err
+	}
+	if err := v.saveSnapshotState(state); err != nil {
+		return err
+	}
+
+	domainXML, err := v.libvirtConnection.DomainSaveImageGetXMLDesc(snapshot.Memory, libvirt.DOMAIN_SAVE_IMAGE_XML_SECURE)
+	if err != nil {
+		return fmt.Errorf("unable to read the snapshot memory state: %w", err)
+	}
+
+	// The memory state was saved while the VM was writing to the snapshot layer,
+	// the restored VM writes to a new layer on top of it
+	snapshotSource := fmt.Sprintf("file='%s'", xmlEscape(snapshot.Disk))
+	if !strings.Contains(domainXML, snapshotSource) {
+		return fmt.Errorf("the snapshot memory state doesn't use the snapshot disk %s", snapshot.Disk)
+	}
+	domainXML = strings.Replace(domainXML, snapshotSource, fmt.Sprintf("file='%s'", xmlEscape(active)), 1)
+
+	v.domain, err = v.libvirtConnection.DomainDefineXMLFlags(domainXML, libvirt.DOMAIN_DEFINE_VALIDATE)
+	if err != nil {
+		return fmt.Errorf("unable to define virtual machine domain: %w", err)
+	}
+
+	defer func() {
+		if err == nil {
+			return
+		}
+		if err := v.Delete(); err != nil {
+			logrus.Errorf("unable to remove VM %s: %v", v.vmName, err)
+		}
+	}()
+
+	err = v.libvirtConnection.DomainRestoreFlags(snapshot.Memory, domainXML, libvirt.DOMAIN_SAVE_RUNNING)
+	if err != nil {
+		return fmt.Errorf("unable to restore the snapshot memory state: %w", err)
+	}
+	events.Record(v.user, v.imageID, events.Start, "restored")
+
+	// The SSH port forwarding is part of the restored VM
+	return v.setConfigSshPort(snapshot.SshPort)
+}
+
+// prepareActiveDisk creates the active layer the VM writes to, on top of the base layer
+func (v *BootcVMLinux) prepareActiveDisk() error {
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return err
+	}
+
+	if err := v.checkDiskImage(state); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(v.snapshotsDir(), 0700); err != nil {
+		return err
+	}
+
+	base := state.baseDisk(v.diskImagePath)
+	active := v.newLayerPath()
+	if err := createOverlay(base, active); err != nil {
+		return err
+	}
+
+	state.setActive(active, base)
+	if err := v.removeUnusedLayers(state); err != nil {
+		return err
+	}
+
+	if err := v.saveSnapshotState(state); err != nil {
+		return err
+	}
+
+	v.activeDiskPath = active
+	return nil
+}
+
+// discardActiveDisk removes the active layer of a stopped VM, unless a snapshot depends on it
+func (v *BootcVMLinux) discardActiveDisk() error {
+	state, err := v.loadSnapshotState()
+	if err != nil {
+		return err
+	}
+
+	if state.Active == "" {
+		return nil
+	}
+
+	state.Active = ""
+	if err := v.removeUnusedLayers(state); err != nil {
+		return err
+	}
+	return v.saveSnapshotState(state)
+}
+
+// checkDiskImage drops the snapshots when the disk image they are created on top of
+// was reinstalled, e.g. because the install options changed
+func (v *BootcVMLinux) checkDiskImage(state *snapshotState) error {
+	info, err := os.Stat(v.diskImagePath)
+	if err != nil {
+		return err
+	}
+
+	identity := fmt.Sprintf("%d-%d", info.Sys().(*syscall.Stat_t).Ino, info.ModTime().UnixNano())
+	if state.DiskImage != "" && state.DiskImage != identity {
+		if len(state.Snapshots) > 0 {
+			logrus.Warningf("The disk image of VM %s was reinstalled, removing its snapshots", v.imageID[:12])
+		}
+		state.Snapshots = nil
+		state.Base = ""
+		state.Active = ""
+	}
+	state.DiskImage = identity
+
+	return v.removeUnusedLayers(state)
+}
+
+// createOverlay creates a qcow2 layer on top of the base layer
+func createOverlay(base, path string) error {
+	cmd := exec.Command("qemu-img", "create", "-q", "-f", "qcow2", "-F", diskFormat(base), "-b", base, path)
+	logrus.Debugf("Executing: %v", cmd.Args)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("unable to create the disk layer: %w: %s", err, out)
+	}
+	return nil
+}
+
+func xmlEscape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
@@ -0,0 +1,200 @@
+//go:build linux
+
+package vm
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/config"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Snapshot layers", func() {
+	var v *BootcVMLinux
+
+	BeforeEach(func() {
+		cacheDir := GinkgoT().TempDir()
+		v = &BootcVMLinux{BootcVMCommon: BootcVMCommon{
+			cacheDir:      cacheDir,
+			diskImagePath: filepath.Join(cacheDir, config.DiskImage),
+			imageID:       "a025064b145ed339eeef86046aea3ee221a2a5a16f588aff4f43a42e5ca9f844",
+		}}
+		Expect(os.WriteFile(v.diskImagePath, nil, 0600)).To(Succeed())
+		Expect(os.MkdirAll(v.snapshotsDir(), 0700)).To(Succeed())
+	})
+
+	// newLayer creates an empty file in place of a qcow2 layer
+	newLayer := func() string {
+		layer := v.newLayerPath()
+		for {
+			if _, err := os.Stat(layer); os.IsNotExist(err) {
+				break
+			}
+			layer = v.newLayerPath()
+		}
+		Expect(os.WriteFile(layer, nil, 0600)).To(Succeed())
+		return layer
+	}
+
+	// start creates the active layer on top of the base layer, as prepareActiveDisk does
+	start := func() string {
+		state, err := v.loadSnapshotState()
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(v.checkDiskImage(state)).To(Succeed())
+
+		active := newLayer()
+		state.setActive(active, state.baseDisk(v.diskImagePath))
+		Expect(v.removeUnusedLayers(state)).To(Succeed())
+		Expect(v.saveSnapshotState(state)).To(Succeed())
+		return active
+	}
+
+	// snapshotRunning freezes the active layer with the memory state, as CreateSnapshot
+	// does for a running VM, and returns the new active layer
+	snapshotRunning := func(name string) string {
+		state, err := v.loadSnapshotState()
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(v.checkDiskImage(state)).To(Succeed())
+
+		snapshot := Snapshot{Name: name, State: SnapshotRunning, Disk: state.Active, Memory: filepath.Join(v.snapshotsDir(), name+".mem")}
+		Expect(os.WriteFile(snapshot.Memory, nil, 0600)).To(Succeed())
+		active := newLayer()
+		state.setActive(active, state.Active)
+		state.Snapshots = append(state.Snapshots, snapshot)
+		Expect(v.saveSnapshotState(state)).To(Succeed())
+		return active
+	}
+
+	// snapshotStopped freezes the base layer, as CreateSnapshot does for a stopped VM
+	snapshotStopped := func(name string) {
+		state, err := v.loadSnapshotState()
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(v.checkDiskImage(state)).To(Succeed())
+
+		state.Snapshots = append(state.Snapshots, Snapshot{Name: name, State: SnapshotShutoff, Disk: state.baseDisk(v.diskImagePath)})
+		Expect(v.saveSnapshotState(state)).To(Succeed())
+	}
+
+	// revert makes the snapshot layer the base layer of the stopped VM, as RevertSnapshot
+	// does for a snapshot without memory
+	revert := func(name string) {
+		state, err := v.loadSnapshotState()
+		Expect(err).To(Not(HaveOccurred()))
+		i := state.findSnapshot(name)
+		Expect(i).To(BeNumerically(">=", 0))
+
+		state.Base = state.Snapshots[i].Disk
+		Expect(v.removeUnusedLayers(state)).To(Succeed())
+		Expect(v.saveSnapshotState(state)).To(Succeed())
+	}
+
+	snapshotFiles := func() []string {
+		entries, err := os.ReadDir(v.snapshotsDir())
+		Expect(err).To(Not(HaveOccurred()))
+		var files []string
+		for _, entry := range entries {
+			if entry.Name() != snapshotsFile {
+				files = append(files, filepath.Join(v.snapshotsDir(), entry.Name()))
+			}
+		}
+		return files
+	}
+
+	loadState := func() *snapshotState {
+		state, err := v.loadSnapshotState()
+		Expect(err).To(Not(HaveOccurred()))
+		return state
+	}
+
+	It("should keep the layers of a chain while a snapshot depends on them", func() {
+		first := start()
+		second := snapshotRunning("s1")
+		third := snapshotRunning("s2")
+		Expect(snapshotFiles()).To(ConsistOf(first, second, third, filepath.Join(v.snapshotsDir(), "s1.mem"), filepath.Join(v.snapshotsDir(), "s2.mem")))
+
+		// s2 and the active layer are on top of the s1 layer
+		Expect(v.DeleteSnapshot("s1")).To(Succeed())
+		Expect(snapshotFiles()).To(ConsistOf(first, second, third, filepath.Join(v.snapshotsDir(), "s2.mem")))
+		Expect(loadState().Backing).To(Equal(map[string]string{first: v.diskImagePath, second: first, third: second}))
+
+		// stopping the VM discards the active layer
+		Expect(v.discardActiveDisk()).To(Succeed())
+		Expect(snapshotFiles()).To(ConsistOf(first, second, filepath.Join(v.snapshotsDir(), "s2.mem")))
+
+		Expect(v.DeleteSnapshot("s2")).To(Succeed())
+		Expect(snapshotFiles()).To(BeEmpty())
+		Expect(loadState().Backing).To(BeEmpty())
+	})
+
+	It("should boot from the reverted snapshot layer", func() {
+		first := start()
+		second := snapshotRunning("s1")
+		Expect(v.discardActiveDisk()).To(Succeed())
+		Expect(snapshotFiles()).To(ConsistOf(first, filepath.Join(v.snapshotsDir(), "s1.mem")))
+
+		revert("s1")
+		Expect(v.CurrentSnapshot()).To(Equal("s1"))
+		Expect(second).To(Not(BeAnExistingFile()))
+
+		active := start()
+		Expect(loadState().Backing).To(Equal(map[string]string{first: v.diskImagePath, active: first}))
+
+		// the base layer is kept once the snapshot is removed
+		Expect(v.DeleteSnapshot("s1")).To(Succeed())
+		Expect(v.CurrentSnapshot()).To(Equal(""))
+		Expect(snapshotFiles()).To(ConsistOf(first, active))
+	})
+
+	It("should remove the layers of the abandoned branch after reverting", func() {
+		start()
+		snapshotStopped("clean")
+		Expect(v.discardActiveDisk()).To(Succeed())
+
+		first := start()
+		second := snapshotRunning("s1")
+		Expect(v.discardActiveDisk()).To(Succeed())
+
+		// the disk image is the base layer of the clean snapshot, s1 keeps its layers
+		revert("clean")
+		Expect(loadState().Base).To(Equal(v.diskImagePath))
+		Expect(snapshotFiles()).To(ConsistOf(first, filepath.Join(v.snapshotsDir(), "s1.mem")))
+		Expect(second).To(Not(BeAnExistingFile()))
+
+		Expect(v.DeleteSnapshot("s1")).To(Succeed())
+		Expect(snapshotFiles()).To(BeEmpty())
+		Expect(v.diskImagePath).To(BeAnExistingFile())
+	})
+
+	It("should remove the files no snapshot depends on", func() {
+		start()
+		snapshotRunning("s1")
+		leftover := newLayer()
+
+		state := loadState()
+		Expect(v.removeUnusedLayers(state)).To(Succeed())
+		Expect(leftover).To(Not(BeAnExistingFile()))
+		Expect(snapshotFiles()).To(HaveLen(3))
+	})
+
+	It("should drop the snapshots when the disk image is reinstalled", func() {
+		start()
+		snapshotRunning("s1")
+		Expect(v.discardActiveDisk()).To(Succeed())
+
+		// a new file with a new inode, as the installation creates
+		Expect(os.Remove(v.diskImagePath)).To(Succeed())
+		Expect(os.WriteFile(v.diskImagePath, nil, 0600)).To(Succeed())
+		Expect(os.Chtimes(v.diskImagePath, time.Now(), time.Now().Add(time.Second))).To(Succeed())
+
+		active := start()
+		Expect(v.ListSnapshots()).To(BeEmpty())
+		Expect(snapshotFiles()).To(ConsistOf(active))
+		state := loadState()
+		Expect(state.Base).To(BeEmpty())
+		Expect(state.Backing).To(Equal(map[string]string{active: v.diskImagePath}))
+	})
+})
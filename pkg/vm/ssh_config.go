@@ -0,0 +1,122 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/user"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// sshConfigHostPrefix prefixes the short VM IDs in the ssh_config Host names
+const sshConfigHostPrefix = "podman-bootc-"
+
+// SSHConfigHost returns the ssh_config Host name of a VM
+func SSHConfigHost(imageID string) string {
+	if len(imageID) > 12 {
+		imageID = imageID[:12]
+	}
+	return sshConfigHostPrefix + imageID
+}
+
+// SSHConfig returns the ssh_config stanza connecting to the VM with the ssh command and
+// the tools using it. The host key of the VM is pinned with the known_hosts file of the VM
+// cache dir, written by WriteSSHConfig.
+func (v *BootcVMCommon) SSHConfig() (string, error) {
+	if err := v.loadSSHParams(); err != nil {
+		return "", err
+	}
+
+	host := SSHConfigHost(v.imageID)
+	hostKey, err := v.sshHostPublicKey()
+	if err != nil {
+		return "", err
+	}
+
+	var knownHosts, strictHostKeyChecking string
+	if hostKey != nil {
+		knownHosts = filepath.Join(v.cacheDir, config.SshKnownHostsFile)
+		strictHostKeyChecking = "yes"
+	} else {
+		// VMs created by older versions have no host key to check
+		knownHosts = os.DevNull
+		strictHostKeyChecking = "no"
+	}
+
+	var stanza strings.Builder
+	fmt.Fprintf(&stanza, "Host %s\n", host)
+	fmt.Fprintf(&stanza, "    HostName localhost\n")
+	fmt.Fprintf(&stanza, "    Port %d\n", v.sshPort)
+	fmt.Fprintf(&stanza, "    User %s\n", v.vmUsername)
+	fmt.Fprintf(&stanza, "    IdentityFile %s\n", sshConfigQuote(v.sshIdentity))
+	fmt.Fprintf(&stanza, "    IdentitiesOnly yes\n")
+	fmt.Fprintf(&stanza, "    HostKeyAlias %s\n", host)
+	fmt.Fprintf(&stanza, "    UserKnownHostsFile %s\n", sshConfigQuote(knownHosts))
+	fmt.Fprintf(&stanza, "    StrictHostKeyChecking %s\n", strictHostKeyChecking)
+	return stanza.String(), nil
+}
+
+// WriteSSHConfig writes the ssh_config stanza of the VM in its cache dir, where the file
+// included by the ssh configuration of the user finds it, with the known_hosts file pinning
+// the host key. It returns the stanza.
+func (v *BootcVMCommon) WriteSSHConfig() (string, error) {
+	stanza, err := v.SSHConfig()
+	if err != nil {
+		return "", err
+	}
+
+	hostKey, err := v.sshHostPublicKey()
+	if err != nil {
+		return "", err
+	}
+	if hostKey != nil {
+		entry := SSHConfigHost(v.imageID) + " " + string(ssh.MarshalAuthorizedKey(hostKey))
+		if err := os.WriteFile(filepath.Join(v.cacheDir, config.SshKnownHostsFile), []byte(entry), 0600); err != nil {
+			return "", fmt.Errorf("write known hosts file: %w", err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(v.cacheDir, config.SshConfigFile), []byte(stanza), 0600); err != nil {
+		return "", fmt.Errorf("write ssh config file: %w", err)
+	}
+	return stanza, nil
+}
+
+// updateSSHConfig writes the ssh_config stanza of the VM, only warning when it fails, the
+// VM works without it
+func (v *BootcVMCommon) updateSSHConfig() {
+	if _, err := v.WriteSSHConfig(); err != nil {
+		logrus.Warningf("unable to update the ssh_config of VM %s: %v", v.imageID, err)
+	}
+}
+
+// WriteSSHConfigInclude writes the ssh_config file including the stanzas of all the VMs
+// and returns its path. The VM stanzas are kept up to date by run and start, and removed
+// with the VM cache dir.
+func WriteSSHConfigInclude(usr user.User) (string, error) {
+	if err := os.MkdirAll(usr.CacheDir(), os.ModePerm); err != nil {
+		return "", err
+	}
+
+	includeFile := filepath.Join(usr.CacheDir(), config.SshConfigFile)
+	content := fmt.Sprintf("# Generated by podman-bootc ssh-config, include it in %s\nInclude %s\n",
+		filepath.Join(usr.SSHDir(), "config"), sshConfigQuote(filepath.Join(usr.CacheDir(), "*", config.SshConfigFile)))
+
+	if err := os.WriteFile(includeFile, []byte(content), 0600); err != nil {
+		return "", fmt.Errorf("write ssh config file: %w", err)
+	}
+	return includeFile, nil
+}
+
+// sshConfigQuote quotes an ssh_config argument containing spaces
+func sshConfigQuote(arg string) string {
+	if strings.ContainsAny(arg, " \t") {
+		return `"` + arg + `"`
+	}
+	return arg
+}
@@ -0,0 +1,254 @@
+package vm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/containers/podman-bootc/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+)
+
+// sshSignalGrace is how long the command may take to exit once the signal interrupting
+// podman-bootc is forwarded to it, before the session is closed
+const sshSignalGrace = 5 * time.Second
+
+// sshDisconnectExitCode is the exit code of a session closed with the ~. escape sequence,
+// the ssh one
+const sshDisconnectExitCode = 255
+
+// forwardedSignals maps the signals forwarded to the command of the session
+var forwardedSignals = map[os.Signal]ssh.Signal{
+	syscall.SIGHUP:  ssh.SIGHUP,
+	syscall.SIGINT:  ssh.SIGINT,
+	syscall.SIGQUIT: ssh.SIGQUIT,
+	syscall.SIGTERM: ssh.SIGTERM,
+	syscall.SIGUSR1: ssh.SIGUSR1,
+	syscall.SIGUSR2: ssh.SIGUSR2,
+}
+
+// escapeReader handles the ssh escape sequences of an interactive session input, the
+// escape character ~ is only recognized at the beginning of a line
+type escapeReader struct {
+	r io.Reader
+	// disconnect closes the session
+	disconnect func()
+	lineStart  bool
+	escaped    bool
+	// disconnecting is set once ~. is read, the session is closed after the input before it is sent
+	disconnecting bool
+}
+
+func newEscapeReader(r io.Reader, disconnect func()) *escapeReader {
+	return &escapeReader{r: r, disconnect: disconnect, lineStart: true}
+}
+
+func (e *escapeReader) Read(p []byte) (int, error) {
+	if e.disconnecting {
+		e.disconnect()
+		return 0, io.EOF
+	}
+
+	buf := make([]byte, len(p))
+	for {
+		n, err := e.r.Read(buf)
+		out := p[:0]
+		for _, c := range buf[:n] {
+			if e.escaped {
+				e.escaped = false
+				switch c {
+				case '.':
+					fmt.Fprint(os.Stderr, "~.\r\n")
+					e.disconnecting = true
+					return len(out), nil
+				case '?':
+					fmt.Fprint(os.Stderr, "~?\r\nSupported escape sequences:\r\n ~.   - terminate connection\r\n ~?   - this message\r\n ~~   - send the escape character by typing it twice\r\n")
+					continue
+				case '~':
+				default:
+					out = append(out, '~')
+				}
+			} else if e.lineStart && c == '~' {
+				e.escaped = true
+				continue
+			}
+
+			e.lineStart = c == '\r' || c == '\n'
+			out = append(out, c)
+		}
+
+		// the escape character alone is held back, wait for the next one
+		if len(out) > 0 || err != nil {
+			return len(out), err
+		}
+	}
+}
+
+// runSSHSession runs the command in the session, or a shell when there is none, with a
+// PTY when stdin is a terminal and there is no command as ssh does
+func runSSHSession(ctx context.Context, client *ssh.Client, session *ssh.Session, command string) error {
+	stdinFd := int(os.Stdin.Fd())
+	tty := command == "" && term.IsTerminal(stdinFd)
+
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+	session.Stdin = os.Stdin
+
+	// the locale of the host may not exist in the VM
+	if err := session.Setenv("LC_ALL", ""); err != nil {
+		logrus.Debugf("unable to set LC_ALL: %v", err)
+	}
+
+	disconnected := make(chan struct{})
+	if tty {
+		width, height, err := term.GetSize(stdinFd)
+		if err != nil {
+			return fmt.Errorf("unable to get the terminal size: %w", err)
+		}
+
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm"
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("unable to allocate a PTY: %w", err)
+		}
+
+		state, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return fmt.Errorf("unable to set the terminal in raw mode: %w", err)
+		}
+		defer func() {
+			if err := term.Restore(stdinFd, state); err != nil {
+				logrus.Warningf("unable to restore the terminal: %v", err)
+			}
+		}()
+
+		session.Stdin = newEscapeReader(os.Stdin, func() {
+			close(disconnected)
+			client.Close()
+		})
+
+		stopResize := forwardWindowSize(session, stdinFd)
+		defer stopResize()
+	}
+
+	var err error
+	if command == "" {
+		err = session.Shell()
+	} else {
+		err = session.Start(command)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to start the SSH session: %w", err)
+	}
+
+	stopSignals := forwardSignals(session)
+	defer stopSignals()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// the signal cancelling ctx is forwarded, give the command time to handle it
+		select {
+		case err = <-done:
+		case <-time.After(sshSignalGrace):
+			client.Close()
+			return ctx.Err()
+		}
+	}
+
+	select {
+	case <-disconnected:
+		return &utils.ExitCodeError{Code: sshDisconnectExitCode}
+	default:
+	}
+
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &utils.ExitCodeError{Code: exitErr.ExitStatus()}
+	}
+	return err
+}
+
+// forwardWindowSize sends the terminal size to the session whenever it changes
+func forwardWindowSize(session *ssh.Session, fd int) (stop func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-winch:
+				width, height, err := term.GetSize(fd)
+				if err != nil {
+					logrus.Debugf("unable to get the terminal size: %v", err)
+					continue
+				}
+				if err := session.WindowChange(height, width); err != nil {
+					logrus.Debugf("unable to change the window size: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
+
+// forwardSignals sends the signals podman-bootc receives to the command of the session
+func forwardSignals(session *ssh.Session) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	for sig := range forwardedSignals {
+		signal.Notify(sigs, sig)
+	}
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				logrus.Debugf("Forwarding %s to the SSH session", sig)
+				if err := session.Signal(forwardedSignals[sig]); err != nil {
+					logrus.Debugf("unable to forward %s: %v", sig, err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
+
+// sshCommand joins the command arguments, the command is run by the user shell as ssh does
+func sshCommand(args []string) string {
+	return strings.Join(args, " ")
+}
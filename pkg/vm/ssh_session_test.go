@@ -0,0 +1,44 @@
+//go:build linux
+
+package vm
+
+import (
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("escapeReader", func() {
+	DescribeTable("should handle the escape sequences",
+		func(chunks []string, sent string, disconnected bool) {
+			disconnects := 0
+			r := newEscapeReader(&chunkReader{chunks: chunks, err: io.EOF}, func() {
+				disconnects++
+			})
+
+			out, err := io.ReadAll(r)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(string(out)).To(Equal(sent))
+			if disconnected {
+				Expect(disconnects).To(Equal(1))
+			} else {
+				Expect(disconnects).To(BeZero())
+			}
+		},
+		Entry("disconnect at the start", []string{"~."}, "", true),
+		Entry("disconnect after a newline", []string{"ls\n~.pwd\n"}, "ls\n", true),
+		Entry("disconnect after a carriage return", []string{"ls\r~."}, "ls\r", true),
+		Entry("disconnect split across reads", []string{"ls\n~", ".pwd\n"}, "ls\n", true),
+		Entry("escaped escape character", []string{"~~."}, "~.", false),
+		Entry("escaped escape character after a newline", []string{"\n~~\n"}, "\n~\n", false),
+		Entry("escaped escape character followed by one", []string{"~~~"}, "~~", false),
+		Entry("help", []string{"~?ls\n"}, "ls\n", false),
+		Entry("help keeps the line start", []string{"~?~."}, "", true),
+		Entry("unknown sequence", []string{"~x"}, "~x", false),
+		Entry("unknown sequence split across reads", []string{"~", "x"}, "~x", false),
+		Entry("not at the start of a line", []string{"ls ~.\n"}, "ls ~.\n", false),
+		Entry("not at the start of a line split across reads", []string{"ls", "~.\n"}, "ls~.\n", false),
+		Entry("no escape character", []string{"ls\n", "pwd\n"}, "ls\npwd\n", false),
+	)
+})
@@ -0,0 +1,34 @@
+package vm
+
+import "time"
+
+// VMStats are the resource usage counters of a running VM, sampled at Time. The CPU,
+// block and network counters are cumulative since the VM started.
+type VMStats struct {
+	Id   string
+	Time time.Time
+	// CPUTime is the CPU time used by the VM, in nanoseconds
+	CPUTime uint64
+	// MemoryUsage and MemoryLimit are the guest memory in use and available to the
+	// guest, in bytes
+	MemoryUsage uint64
+	MemoryLimit uint64
+	// BlockRead and BlockWrite are the bytes read from and written to the VM disk
+	BlockRead  int64
+	BlockWrite int64
+	// NetAvailable is false when the VM has no host side network interface, e.g.
+	// with the built-in user mode network, NetRx and NetTx are unknown then
+	NetAvailable bool
+	NetRx        int64
+	NetTx        int64
+}
+
+// CPUPercent returns the CPU usage between two samples of the same VM, as a
+// percentage of one host CPU
+func (s VMStats) CPUPercent(previous VMStats) float64 {
+	elapsed := s.Time.Sub(previous.Time)
+	if elapsed <= 0 || s.CPUTime < previous.CPUTime {
+		return 0
+	}
+	return float64(s.CPUTime-previous.CPUTime) / float64(elapsed.Nanoseconds()) * 100
+}
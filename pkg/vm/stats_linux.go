@@ -0,0 +1,147 @@
+package vm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"libvirt.org/go/libvirt"
+)
+
+// CollectStats samples the resource usage of all the running podman-bootc libvirt domains
+func CollectStats(libvirtUri string) ([]VMStats, error) {
+	conn, err := libvirt.NewConnect(libvirtUri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to libvirt: %w", err)
+	}
+	defer conn.Close()
+
+	domains, err := conn.ListAllDomains(libvirt.CONNECT_LIST_DOMAINS_ACTIVE)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list all domains: %w", err)
+	}
+	defer func() {
+		for _, domain := range domains {
+			domain.Free()
+		}
+	}()
+
+	var stats []VMStats
+	for _, domain := range domains {
+		name, err := domain.GetName()
+		if err != nil {
+			return nil, err
+		}
+
+		id, ok := strings.CutPrefix(name, domainPrefix)
+		if !ok {
+			continue
+		}
+
+		s, err := domainStats(&domain)
+		if err != nil {
+			// the domain may have been stopped since it was listed
+			if errors.Is(err, libvirt.ERR_NO_DOMAIN) || errors.Is(err, libvirt.ERR_OPERATION_INVALID) {
+				continue
+			}
+			return nil, fmt.Errorf("unable to get the stats of %s: %w", id, err)
+		}
+		s.Id = id
+		stats = append(stats, *s)
+	}
+
+	return stats, nil
+}
+
+func domainStats(domain *libvirt.Domain) (*VMStats, error) {
+	s := &VMStats{Time: time.Now()}
+
+	cpuStats, err := domain.GetCPUStats(-1, 1, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(cpuStats) > 0 {
+		s.CPUTime = cpuStats[0].CpuTime
+	}
+
+	// the balloon driver reports the guest memory usage, fall back to the memory
+	// used by the VM process otherwise
+	memStats, err := domain.MemoryStats(uint32(libvirt.DOMAIN_MEMORY_STAT_NR), 0)
+	if err != nil {
+		return nil, err
+	}
+	mem := map[libvirt.DomainMemoryStatTags]uint64{}
+	for _, stat := range memStats {
+		mem[libvirt.DomainMemoryStatTags(stat.Tag)] = stat.Val * 1024
+	}
+
+	s.MemoryLimit = mem[libvirt.DOMAIN_MEMORY_STAT_ACTUAL_BALLOON]
+	if s.MemoryLimit == 0 {
+		maxMemory, err := domain.GetMaxMemory()
+		if err != nil {
+			return nil, err
+		}
+		s.MemoryLimit = maxMemory * 1024
+	}
+
+	available, hasAvailable := mem[libvirt.DOMAIN_MEMORY_STAT_AVAILABLE]
+	unused, hasUnused := mem[libvirt.DOMAIN_MEMORY_STAT_UNUSED]
+	if hasAvailable && hasUnused && available >= unused {
+		s.MemoryUsage = available - unused
+	} else {
+		s.MemoryUsage = mem[libvirt.DOMAIN_MEMORY_STAT_RSS]
+	}
+
+	blockStats, err := domain.BlockStats("vda")
+	if err != nil {
+		return nil, err
+	}
+	s.BlockRead = blockStats.RdBytes
+	s.BlockWrite = blockStats.WrBytes
+
+	interfaces, err := domainInterfaces(domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, iface := range interfaces {
+		ifaceStats, err := domain.InterfaceStats(iface)
+		if err != nil {
+			return nil, err
+		}
+		s.NetAvailable = true
+		s.NetRx += ifaceStats.RxBytes
+		s.NetTx += ifaceStats.TxBytes
+	}
+
+	return s, nil
+}
+
+// domainInterfaces returns the host side devices of the domain network interfaces. The
+// built-in user mode network is set on the qemu command line, it has none.
+func domainInterfaces(domain *libvirt.Domain) ([]string, error) {
+	domainXML, err := domain.GetXMLDesc(0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the domain XML: %w", err)
+	}
+
+	var desc struct {
+		Interfaces []struct {
+			Target struct {
+				Dev string `xml:"dev,attr"`
+			} `xml:"target"`
+		} `xml:"devices>interface"`
+	}
+	if err := xml.Unmarshal([]byte(domainXML), &desc); err != nil {
+		return nil, fmt.Errorf("unable to parse the domain XML: %w", err)
+	}
+
+	var devs []string
+	for _, iface := range desc.Interfaces {
+		if iface.Target.Dev != "" {
+			devs = append(devs, iface.Target.Dev)
+		}
+	}
+	return devs, nil
+}
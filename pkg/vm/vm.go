@@ -1,11 +1,13 @@
 package vm
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -13,6 +15,7 @@ import (
 
 	"github.com/containers/podman-bootc/pkg/bootc"
 	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/events"
 	"github.com/containers/podman-bootc/pkg/user"
 	"github.com/containers/podman-bootc/pkg/utils"
 
@@ -23,6 +26,79 @@ import (
 
 var ErrVMInUse = errors.New("VM already in use")
 
+// Firmware types of the VM
+const (
+	FirmwareBIOS          = "bios"
+	FirmwareEFI           = "efi"
+	FirmwareEFISecureBoot = "efi-secboot"
+)
+
+// States of the VM
+const (
+	StateRunning = "running"
+	StatePaused  = "paused"
+	// StateSaved is a stopped VM whose memory state was saved, it resumes when restored
+	StateSaved   = "saved"
+	StateStopped = "stopped"
+)
+
+// TPM versions of the VM
+const (
+	TPMNone = "none"
+	TPM12   = "1.2"
+	TPM20   = "2.0"
+)
+
+// Restart policies of the VM
+const (
+	RestartNo        = "no"         // never restart the VM
+	RestartOnFailure = "on-failure" // restart the VM when it crashes
+	RestartAlways    = "always"     // restart the VM when it stops, and when the host boots
+)
+
+// The measured boot event log, as exposed by the guest kernel
+const tpmEventLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+
+// The UEFI variable telling whether Secure Boot is enabled
+const secureBootEfiVar = "/sys/firmware/efi/efivars/SecureBoot-8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// ValidateFirmware checks the firmware options, the architecture specific checks
+// are done when the VM is created
+func ValidateFirmware(firmware string, enrollKeysDir string) error {
+	switch firmware {
+	case "", FirmwareBIOS, FirmwareEFI, FirmwareEFISecureBoot:
+	default:
+		return fmt.Errorf("invalid firmware %q, use one of %s, %s or %s", firmware, FirmwareBIOS, FirmwareEFI, FirmwareEFISecureBoot)
+	}
+
+	if enrollKeysDir != "" && firmware != FirmwareEFISecureBoot {
+		return fmt.Errorf("enrolling Secure Boot keys requires the %s firmware", FirmwareEFISecureBoot)
+	}
+
+	return nil
+}
+
+// ValidateTPM checks the TPM version, the architecture specific checks are done
+// when the VM is created
+func ValidateTPM(tpm string) error {
+	switch tpm {
+	case "", TPMNone, TPM12, TPM20:
+		return nil
+	default:
+		return fmt.Errorf("invalid TPM version %q, use one of %s, %s or %s", tpm, TPMNone, TPM12, TPM20)
+	}
+}
+
+// ValidateRestartPolicy checks the restart policy
+func ValidateRestartPolicy(restart string) error {
+	switch restart {
+	case "", RestartNo, RestartOnFailure, RestartAlways:
+		return nil
+	default:
+		return fmt.Errorf("invalid restart policy %q, use one of %s, %s or %s", restart, RestartNo, RestartOnFailure, RestartAlways)
+	}
+}
+
 // GetVMCachePath returns the path to the VM cache directory
 func GetVMCachePath(imageId string, user user.User) (longID string, path string, err error) {
 	files, err := os.ReadDir(user.CacheDir())
@@ -45,10 +121,12 @@ func GetVMCachePath(imageId string, user user.User) (longID string, path string,
 }
 
 type NewVMParameters struct {
-	ImageID    string
-	User       user.User //user who is running the podman bootc command
-	LibvirtUri string    //linux only
-	Locking    utils.AccessMode
+	ImageID     string
+	User        user.User //user who is running the podman bootc command
+	LibvirtUri  string    //linux only
+	Locking     utils.AccessMode
+	LockTimeout time.Duration   //how long to wait for a VM in use, zero means don't wait
+	Ctx         context.Context //cancels waiting for the lock, optional
 }
 
 type RunVMParameters struct {
@@ -60,19 +138,48 @@ type RunVMParameters struct {
 	Cmd           []string
 	RemoveVm      bool
 	Background    bool
+	Arch          string //VM architecture, e.g. aarch64, defaults to the host one
+	Firmware      string //one of the Firmware* types, defaults to the architecture one
+	EnrollKeysDir string //directory of the Secure Boot keys to enroll, efi-secboot only
+	Tpm           string //one of the TPM* versions, defaults to the architecture one
+	Restart       string //one of the Restart* policies, defaults to RestartNo
+	Vsock         bool   //run the commands over vsock instead of SSH
 }
 
 type BootcVM interface {
-	Run(RunVMParameters) error
+	Run(context.Context, RunVMParameters) error
+	Start(context.Context) error
 	Delete() error
 	IsRunning() (bool, error)
+	State() (string, error)
+	Pause() error
+	Unpause() error
+	Save() error
+	Restore() error
 	WriteConfig(bootc.BootcDisk) error
-	WaitForSSHToBeReady() error
-	RunSSH([]string) error
+	WaitForSSHToBeReady(context.Context) error
+	WaitForReady(context.Context, []ReadinessProbe, time.Duration) error
+	RunSSH(context.Context, []string) error
+	CopyToVM(ctx context.Context, src string, dst string, recursive bool) error
+	CopyFromVM(ctx context.Context, src string, dst string, recursive bool) error
+	CopyTarToVM(ctx context.Context, r io.Reader, dst string) error
+	CopyTarFromVM(ctx context.Context, w io.Writer, src string) error
 	DeleteFromCache() error
 	CacheDir() string
+	SSHConfig() (string, error)
+	WriteSSHConfig() (string, error)
 	Exists() (bool, error)
 	GetConfig() (*BootcVMConfig, error)
+	SecureBootActive() (bool, error)
+	TPMEventLog() (*EventLog, error)
+	GuestInfo() (*GuestInfo, error)
+	AgentExec(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) (int, error)
+	CreateSnapshot(name string, diskOnly bool) (*Snapshot, error)
+	ListSnapshots() ([]Snapshot, error)
+	CurrentSnapshot() (string, error)
+	RevertSnapshot(name string) error
+	DeleteSnapshot(name string) error
+	DiskUsage() (*DiskUsage, error)
 	CloseConnection()
 	PrintConsole() error
 	Unlock() error
@@ -95,16 +202,41 @@ type BootcVMCommon struct {
 	cloudInitDir  string
 	cloudInitArgs string
 	cacheDirLock  utils.CacheLock
+	arch          string
+	firmware      string
+	enrollKeysDir string
+	tpm           string
+	restart       string
+	vsock         bool
 }
 
 type BootcVMConfig struct {
 	Id          string `json:"Id,omitempty"`
 	SshPort     int    `json:"SshPort"`
 	SshIdentity string `json:"SshPriKey"`
+	SshUser     string `json:"SshUser,omitempty"`
 	RepoTag     string `json:"Repository"`
 	Created     string `json:"Created,omitempty"`
 	DiskSize    string `json:"DiskSize,omitempty"`
+	DiskUsage   string `json:"DiskUsage,omitempty"`
 	Running     bool   `json:"Running,omitempty"`
+	State       string `json:"State,omitempty"`
+	Firmware    string `json:"Firmware,omitempty"`
+	Tpm         string `json:"Tpm,omitempty"`
+	Restart     string `json:"Restart,omitempty"`
+	Arch        string `json:"Arch,omitempty"`
+	EnrollKeys  string `json:"EnrollKeys,omitempty"`
+	Vsock       bool   `json:"Vsock,omitempty"`
+}
+
+// DiskUsage is the disk space allocated to a VM in the cache, in bytes
+type DiskUsage struct {
+	Disk      int64 `json:"Disk"`
+	CloudInit int64 `json:"CloudInit"`
+	Keys      int64 `json:"Keys"`
+	Snapshots int64 `json:"Snapshots"`
+	// Total includes any other file in the VM cache dir, e.g. temporary disks
+	Total int64 `json:"Total"`
 }
 
 // writeConfig writes the configuration for the VM to the disk
@@ -117,9 +249,16 @@ func (v *BootcVMCommon) WriteConfig(bootcDisk bootc.BootcDisk) error {
 		Id:          v.imageID[0:12],
 		SshPort:     v.sshPort,
 		SshIdentity: v.sshIdentity,
+		SshUser:     v.vmUsername,
 		RepoTag:     bootcDisk.GetRepoTag(),
 		Created:     bootcDisk.GetCreatedAt().Format(time.RFC3339),
 		DiskSize:    strconv.FormatInt(size, 10),
+		Firmware:    v.firmware,
+		Tpm:         v.tpm,
+		Restart:     v.restart,
+		Arch:        v.arch,
+		EnrollKeys:  v.enrollKeysDir,
+		Vsock:       v.vsock,
 	}
 
 	bcConfigMsh, err := json.Marshal(bcConfig)
@@ -131,8 +270,9 @@ func (v *BootcVMCommon) WriteConfig(bootcDisk bootc.BootcDisk) error {
 	if err != nil {
 		return fmt.Errorf("write config file: %w", err)
 	}
-	return nil
 
+	v.updateSSHConfig()
+	return nil
 }
 
 func (v *BootcVMCommon) LoadConfigFile() (cfg *BootcVMConfig, err error) {
@@ -160,9 +300,112 @@ func (v *BootcVMCommon) LoadConfigFile() (cfg *BootcVMConfig, err error) {
 	}
 	cfg.DiskSize = units.HumanSizeWithPrecision(diskSizeFloat, 3)
 
+	// the disk image is sparse, its size is far from what it uses
+	diskUsage, err := utils.AllocatedSize(v.diskImagePath)
+	if err != nil {
+		return nil, fmt.Errorf("error getting disk usage: %w", err)
+	}
+	cfg.DiskUsage = units.HumanSizeWithPrecision(float64(diskUsage), 3)
+
 	return
 }
 
+// setConfigSshPort updates the SSH port of the VM config file
+func (v *BootcVMCommon) setConfigSshPort(port int) error {
+	cfgFile := filepath.Join(v.cacheDir, config.CfgFile)
+	content, err := os.ReadFile(cfgFile)
+	if err != nil {
+		return err
+	}
+
+	// the config values are formatted for display when loaded, update the raw ones
+	cfg := map[string]any{}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return fmt.Errorf("unmarshal config data: %w", err)
+	}
+	cfg["SshPort"] = port
+
+	content, err = json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal config data: %w", err)
+	}
+
+	if err := os.WriteFile(cfgFile, content, 0660); err != nil {
+		return fmt.Errorf("write config file: %w", err)
+	}
+
+	// the ssh_config stanza has the port too
+	v.updateSSHConfig()
+	return nil
+}
+
+// startParameters returns the parameters to run the VM again in the background, as
+// it was last run, with a new SSH port
+func (v *BootcVMCommon) startParameters() (params RunVMParameters, err error) {
+	cfg, err := v.LoadConfigFile()
+	if err != nil {
+		return params, fmt.Errorf("failed to load VM config: %w", err)
+	}
+
+	sshPort, err := utils.GetFreeLocalTcpPort()
+	if err != nil {
+		return params, fmt.Errorf("unable to get free port for SSH: %w", err)
+	}
+
+	params = RunVMParameters{
+		Background:    true,
+		SSHPort:       sshPort,
+		SSHIdentity:   cfg.SshIdentity,
+		VMUser:        cfg.SshUser,
+		Arch:          cfg.Arch,
+		Firmware:      cfg.Firmware,
+		EnrollKeysDir: cfg.EnrollKeys,
+		Tpm:           cfg.Tpm,
+		Restart:       cfg.Restart,
+		Vsock:         cfg.Vsock,
+	}
+	// VMs created by older versions didn't record the user
+	if params.VMUser == "" {
+		params.VMUser = "root"
+	}
+	return params, nil
+}
+
+// DiskUsage returns the disk space allocated to the VM files
+func (v *BootcVMCommon) DiskUsage() (*DiskUsage, error) {
+	usage := &DiskUsage{}
+	files := []struct {
+		path string
+		size *int64
+	}{
+		{v.diskImagePath, &usage.Disk},
+		{filepath.Join(v.cacheDir, config.CiDataIso), &usage.CloudInit},
+		{filepath.Join(v.cacheDir, config.SshKeyFile), &usage.Keys},
+		{filepath.Join(v.cacheDir, config.SshKeyFile+".pub"), &usage.Keys},
+		{filepath.Join(v.cacheDir, config.SshHostKeyFile), &usage.Keys},
+		{filepath.Join(v.cacheDir, config.SshHostKeyFile+".pub"), &usage.Keys},
+		{filepath.Join(v.cacheDir, config.SshKnownHostsFile), &usage.Keys},
+		{filepath.Join(v.cacheDir, config.VsockTokenFile), &usage.Keys},
+		{filepath.Join(v.cacheDir, config.SnapshotsDir), &usage.Snapshots},
+	}
+
+	for _, f := range files {
+		size, err := utils.AllocatedSize(f.path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		*f.size += size
+	}
+
+	total, err := utils.AllocatedSize(v.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	usage.Total = total
+
+	return usage, nil
+}
+
 func (v *BootcVMCommon) SetUser(user string) error {
 	if user == "" {
 		return fmt.Errorf("user is required")
@@ -172,22 +415,18 @@ func (v *BootcVMCommon) SetUser(user string) error {
 	return nil
 }
 
-func (v *BootcVMCommon) WaitForSSHToBeReady() error {
-	timeout := 1 * time.Minute
-	elapsed := 0 * time.Millisecond
-	interval := 500 * time.Millisecond
-
+func (v *BootcVMCommon) sshClientConfig() (*ssh.ClientConfig, error) {
 	key, err := os.ReadFile(v.sshIdentity)
 	if err != nil {
-		return fmt.Errorf("failed to read private key file: %s\n", err)
+		return nil, fmt.Errorf("failed to read private key file: %s\n", err)
 	}
 
 	signer, err := ssh.ParsePrivateKey(key)
 	if err != nil {
-		return fmt.Errorf("failed to parse private key: %s\n", err)
+		return nil, fmt.Errorf("failed to parse private key: %s\n", err)
 	}
 
-	config := &ssh.ClientConfig{
+	clientConfig := &ssh.ClientConfig{
 		User: v.vmUsername,
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
@@ -196,23 +435,82 @@ func (v *BootcVMCommon) WaitForSSHToBeReady() error {
 		Timeout:         1 * time.Second,
 	}
 
-	for elapsed < timeout {
-		client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", "localhost", v.sshPort), config)
-		if err != nil {
-			logrus.Debugf("failed to connect to SSH server: %s\n", err)
-			time.Sleep(interval)
-			elapsed += interval
-		} else {
-			client.Close()
-			return nil
-		}
+	hostKey, err := v.sshHostPublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if hostKey == nil {
+		logrus.Debugf("VM %s has no SSH host key, created by an older podman-bootc, not checking it", v.imageID)
+		return clientConfig, nil
+	}
+
+	// the VM has the host key injected by podman-bootc, the only one accepted
+	clientConfig.HostKeyCallback = ssh.FixedHostKey(hostKey)
+	clientConfig.HostKeyAlgorithms = []string{hostKey.Type()}
+	if hostKey.Type() == ssh.KeyAlgoRSA {
+		clientConfig.HostKeyAlgorithms = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return clientConfig, nil
+}
+
+// sshHostPublicKey returns the SSH host key of the VM, nil when it doesn't have one
+func (v *BootcVMCommon) sshHostPublicKey() (ssh.PublicKey, error) {
+	hostKey, err := sshHostKey(v.cacheDir)
+	if err != nil || hostKey == "" {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(hostKey + ".pub")
+	if err != nil {
+		return nil, err
 	}
 
-	return fmt.Errorf("SSH did not become ready in %s seconds", timeout)
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the SSH host key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// SecureBootActive reports whether the running VM booted with Secure Boot enabled,
+// reading the SecureBoot UEFI variable over SSH
+func (v *BootcVMCommon) SecureBootActive() (bool, error) {
+	// The variable is missing without UEFI, its content is 4 bytes of attributes and the value
+	out, err := v.sshOutput("cat " + secureBootEfiVar + " 2>/dev/null || true")
+	if err != nil {
+		return false, fmt.Errorf("failed to read the SecureBoot UEFI variable: %w", err)
+	}
+
+	return len(out) == 5 && out[4] == 1, nil
+}
+
+// TPMEventLog reads and parses the measured boot event log of the running VM over SSH
+func (v *BootcVMCommon) TPMEventLog() (*EventLog, error) {
+	command := "cat " + tpmEventLogPath
+	cfg, err := v.LoadConfigFile()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load VM config: %w", err)
+	}
+
+	if cfg.Tpm == TPMNone {
+		return nil, errors.New("the VM has no TPM")
+	}
+
+	// securityfs is only readable by root
+	if cfg.SshUser != "" && cfg.SshUser != "root" {
+		command = "sudo -n " + command
+	}
+
+	out, err := v.sshOutput(command)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the TPM event log: %w", err)
+	}
+
+	return ParseEventLog(out)
 }
 
-// RunSSH runs a command over ssh or starts an interactive ssh connection if no command is provided
-func (v *BootcVMCommon) RunSSH(inputArgs []string) error {
+// loadSSHParams sets the SSH parameters of the VM from its config
+func (v *BootcVMCommon) loadSSHParams() error {
 	cfg, err := v.LoadConfigFile()
 	if err != nil {
 		return fmt.Errorf("failed to load VM config: %w", err)
@@ -220,55 +518,167 @@ func (v *BootcVMCommon) RunSSH(inputArgs []string) error {
 
 	v.sshPort = cfg.SshPort
 	v.sshIdentity = cfg.SshIdentity
+	v.vsock = cfg.Vsock
+	v.vmUsername = cfg.SshUser
+	// VMs created by older versions didn't record the user
+	if v.vmUsername == "" {
+		v.vmUsername = "root"
+	}
+	return nil
+}
 
-	sshDestination := v.vmUsername + "@localhost"
-	port := strconv.Itoa(v.sshPort)
-
-	args := []string{"-i", v.sshIdentity, "-p", port, sshDestination,
-		"-o", "IdentitiesOnly=yes",
-		"-o", "PasswordAuthentication=no",
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "LogLevel=ERROR",
-		"-o", "SetEnv=LC_ALL=",
-		"-o", "UserKnownHostsFile=/dev/null"}
-	if len(inputArgs) > 0 {
-		args = append(args, inputArgs...)
-	} else {
-		fmt.Printf("Connecting to vm %s. To close connection, use `~.` or `exit`\n", v.imageID)
+// sshOutput runs a command in the running VM and returns its standard output, over
+// vsock when the VM has the vsock shell
+func (v *BootcVMCommon) sshOutput(command string) ([]byte, error) {
+	if err := v.loadSSHParams(); err != nil {
+		return nil, err
+	}
+
+	if v.vsock {
+		return v.vsockOutput(command)
+	}
+
+	config, err := v.sshClientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", "localhost", v.sshPort), config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stderr = &stderr
+	out, err := session.Output(command)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return out, nil
+}
+
+// RunSSH runs a command over ssh or starts an interactive ssh connection if no command is provided,
+// over vsock instead when the VM has the vsock shell. The exit code of the command is returned
+// as an utils.ExitCodeError. Cancelling ctx forwards the signal to the command, then closes the
+// connection if it doesn't exit.
+func (v *BootcVMCommon) RunSSH(ctx context.Context, inputArgs []string) error {
+	cfg, err := v.LoadConfigFile()
+	if err != nil {
+		return fmt.Errorf("failed to load VM config: %w", err)
+	}
+
+	v.sshPort = cfg.SshPort
+	v.sshIdentity = cfg.SshIdentity
+
+	if cfg.Vsock {
+		return v.runVsock(ctx, inputArgs)
 	}
 
-	cmd := exec.Command("ssh", args...)
+	config, err := v.sshClientConfig()
+	if err != nil {
+		return err
+	}
+
+	logrus.Debugf("Connecting to %s@localhost:%d", v.vmUsername, v.sshPort)
+	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", "localhost", v.sshPort), config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to SSH server: %w", err)
+	}
+	defer client.Close()
 
-	logrus.Debugf("Running ssh command: %s", cmd.String())
+	session, err := client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	if len(inputArgs) == 0 {
+		fmt.Printf("Connecting to vm %s. To close connection, use `~.` or `exit`\n", v.imageID)
+	}
 
-	return cmd.Run()
+	return runSSHSession(ctx, client, session, sshCommand(inputArgs))
 }
 
 // Delete removes the VM disk image and the VM configuration from the podman-bootc cache
 func (v *BootcVMCommon) DeleteFromCache() error {
-	return os.RemoveAll(v.cacheDir)
+	if err := os.RemoveAll(v.cacheDir); err != nil {
+		return err
+	}
+
+	events.Record(v.user, v.imageID, events.Remove, "")
+	return nil
 }
 
 func (v *BootcVMCommon) CacheDir() string {
 	return v.cacheDir
 }
 
-func (b *BootcVMCommon) oemString() (string, error) {
-	systemdOemString, err := oemStringSystemdCredential(b.vmUsername, b.sshIdentity)
+func (b *BootcVMCommon) oemStrings() ([]string, error) {
+	hostKey, err := sshHostKey(b.cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	systemdOemString, err := oemStringSystemdCredential(b.vmUsername, b.sshIdentity, hostKey)
+	if err != nil {
+		return nil, err
+	}
+	oemStrings := []string{systemdOemString}
+
+	if b.vsock {
+		oemStrings = append(oemStrings, oemStringsVsockShell(b.vmUsername)...)
+	}
+
+	var smbios []string
+	for _, oemString := range oemStrings {
+		smbios = append(smbios, fmt.Sprintf("type=11,value=%s", oemString))
+	}
+	return smbios, nil
+}
+
+// fileCredential is a systemd credential read from a file by the hypervisor, the secrets
+// don't appear on its command line
+type fileCredential struct {
+	name string
+	path string
+}
+
+// fileCredentials returns the secret systemd credentials of the VM
+func (b *BootcVMCommon) fileCredentials() ([]fileCredential, error) {
+	var credentials []fileCredential
+	hostKey, err := sshHostKey(b.cacheDir)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if hostKey != "" {
+		credentials = append(credentials, fileCredential{sshHostKeyCredential, hostKey})
 	}
 
-	return fmt.Sprintf("type=11,value=%s", systemdOemString), nil
+	if b.vsock {
+		if _, err := b.vsockToken(true); err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, fileCredential{vsockTokenCredential, filepath.Join(b.cacheDir, config.VsockTokenFile)})
+	}
+	return credentials, nil
 }
 
 func lockVM(params NewVMParameters, cacheDir string) (utils.CacheLock, error) {
+	ctx := params.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
 	lock := utils.NewCacheLock(params.User.RunDir(), cacheDir)
-	locked, err := lock.TryLock(params.Locking)
+	locked, err := lock.TryLockWithTimeout(ctx, params.Locking, params.LockTimeout)
 	if err != nil {
 		return lock, fmt.Errorf("unable to lock the VM cache path: %w", err)
 	}
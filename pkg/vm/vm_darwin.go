@@ -1,13 +1,17 @@
 package vm
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 
 	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/events"
 	"github.com/containers/podman-bootc/pkg/utils"
 
 	"github.com/sirupsen/logrus"
@@ -18,6 +22,18 @@ type BootcVMMac struct {
 	BootcVMCommon
 }
 
+// SSHHostKeyInjected is set when the VMs get the SSH host key generated on the host. krunkit
+// can only pass it on its command line, where the other users could read the private key.
+const SSHHostKeyInjected = false
+
+// ValidateArch checks the architecture of the VM, only the host one can run on macOS
+func ValidateArch(arch string) error {
+	if arch != "" && arch != utils.HostArch() {
+		return fmt.Errorf("running %s VMs on a %s host is not supported on macOS", arch, utils.HostArch())
+	}
+	return nil
+}
+
 func NewVM(params NewVMParameters) (vm *BootcVMMac, err error) {
 	if params.ImageID == "" {
 		return nil, fmt.Errorf("image ID is required")
@@ -49,6 +65,31 @@ func NewVM(params NewVMParameters) (vm *BootcVMMac, err error) {
 
 }
 
+// ListDomainIDs returns nothing, there are no libvirt domains on macOS
+func ListDomainIDs(libvirtUri string) ([]string, error) {
+	return nil, nil
+}
+
+// CollectStats is not supported, the VM monitor doesn't expose any usage counters
+func CollectStats(libvirtUri string) ([]VMStats, error) {
+	return nil, errors.New("VM stats are not supported on macOS")
+}
+
+// LifecycleReportedLive is set when WatchLifecycle reports the lifecycle events
+const LifecycleReportedLive = false
+
+// WatchLifecycle reports nothing, there are no libvirt domains on macOS. It blocks until
+// ctx is done.
+func WatchLifecycle(ctx context.Context, libvirtUri string, report func(events.Event)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// RemoveDomain is a no-op, there are no libvirt domains on macOS
+func RemoveDomain(libvirtUri string, shortId string) error {
+	return nil
+}
+
 func (b *BootcVMMac) CloseConnection() {
 	return //no-op when using qemu
 }
@@ -67,14 +108,30 @@ func (b *BootcVMMac) GetConfig() (cfg *BootcVMConfig, err error) {
 	pid, _ := utils.ReadPidFile(vmPidFile)
 	if pid != -1 && utils.IsProcessAlive(pid) {
 		cfg.Running = true
+		cfg.State = StateRunning
 	} else {
 		cfg.Running = false
+		cfg.State = StateStopped
 	}
 
 	return
 }
 
-func (b *BootcVMMac) Run(params RunVMParameters) (err error) {
+// Run starts the VM monitor in the background. The monitor must outlive this
+// process, so ctx is only checked before spawning it.
+func (b *BootcVMMac) Run(ctx context.Context, params RunVMParameters) (err error) {
+	if params.Firmware != "" && params.Firmware != FirmwareEFI {
+		return fmt.Errorf("the %s firmware is not supported on macOS", params.Firmware)
+	}
+
+	if params.Tpm != "" && params.Tpm != TPMNone {
+		return fmt.Errorf("TPM %s is not supported on macOS", params.Tpm)
+	}
+
+	if params.Vsock {
+		return errors.New("vsock is not supported on macOS")
+	}
+
 	b.sshPort = params.SSHPort
 	b.removeVm = params.RemoveVm
 	b.background = params.Background
@@ -83,6 +140,13 @@ func (b *BootcVMMac) Run(params RunVMParameters) (err error) {
 	b.cloudInitDir = params.CloudInitDir
 	b.vmUsername = params.VMUser
 	b.sshIdentity = params.SSHIdentity
+	b.firmware = FirmwareEFI
+	b.tpm = TPMNone
+	b.arch = utils.HostArch()
+	b.restart = params.Restart
+	if b.restart == "" {
+		b.restart = RestartNo
+	}
 
 	execPath, err := os.Executable()
 	if err != nil {
@@ -99,13 +163,47 @@ func (b *BootcVMMac) Run(params RunVMParameters) (err error) {
 		return fmt.Errorf("getting executable absolute path: %w", err)
 	}
 
-	args := []string{"vmmon", b.imageID, b.vmUsername, b.sshIdentity, strconv.Itoa(b.sshPort)}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := ValidateArch(params.Arch); err != nil {
+		return err
+	}
+
+	args := []string{"vmmon", "--restart", b.restart, b.imageID, b.vmUsername, b.sshIdentity, strconv.Itoa(b.sshPort)}
 	cmd := exec.Command(execPath, args...)
 
 	logrus.Debugf("Executing: %v", cmd.Args)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	return cmd.Start()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	events.Record(b.user, b.imageID, events.Start, "")
+	return nil
+}
+
+// Start runs the stopped VM again in the background
+func (b *BootcVMMac) Start(ctx context.Context) error {
+	isRunning, err := b.IsRunning()
+	if err != nil {
+		return fmt.Errorf("checking if VM is running: %w", err)
+	}
+	if isRunning {
+		return errors.New("VM is already running")
+	}
+
+	params, err := b.startParameters()
+	if err != nil {
+		return err
+	}
+
+	if err := b.Run(ctx, params); err != nil {
+		return err
+	}
+	return b.setConfigSshPort(params.SSHPort)
 }
 
 func (b *BootcVMMac) Delete() error {
@@ -130,7 +228,12 @@ func (b *BootcVMMac) Delete() error {
 		return fmt.Errorf("process not found while attempting to delete VM: %w", err)
 	}
 
-	return process.Signal(os.Interrupt)
+	if err := process.Signal(os.Interrupt); err != nil {
+		return err
+	}
+
+	events.Record(b.user, b.imageID, events.Stop, "destroyed")
+	return nil
 }
 
 func (b *BootcVMMac) IsRunning() (bool, error) {
@@ -159,3 +262,47 @@ func (b *BootcVMMac) Exists() (bool, error) {
 func (v *BootcVMMac) Unlock() error {
 	return v.cacheDirLock.Unlock()
 }
+
+func (b *BootcVMMac) State() (string, error) {
+	isRunning, err := b.IsRunning()
+	if err != nil {
+		return "", err
+	}
+
+	if isRunning {
+		return StateRunning, nil
+	}
+	return StateStopped, nil
+}
+
+func (b *BootcVMMac) Pause() error {
+	return errors.New("pausing a VM is not supported on macOS")
+}
+
+func (b *BootcVMMac) Unpause() error {
+	return errors.New("pausing a VM is not supported on macOS")
+}
+
+func (b *BootcVMMac) Save() error {
+	return errors.New("saving a VM is not supported on macOS")
+}
+
+func (b *BootcVMMac) Restore() error {
+	return errors.New("saving a VM is not supported on macOS")
+}
+
+func (b *BootcVMMac) CreateSnapshot(name string, diskOnly bool) (*Snapshot, error) {
+	return nil, errors.New("snapshots are not supported on macOS")
+}
+
+func (b *BootcVMMac) GuestInfo() (*GuestInfo, error) {
+	return nil, errors.New("the guest agent is not supported on macOS")
+}
+
+func (b *BootcVMMac) AgentExec(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) (int, error) {
+	return 0, errors.New("the guest agent is not supported on macOS")
+}
+
+func (b *BootcVMMac) RevertSnapshot(name string) error {
+	return errors.New("snapshots are not supported on macOS")
+}
@@ -2,15 +2,20 @@ package vm
 
 import (
 	"bytes"
+	"context"
 	_ "embed"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"text/template"
 	"time"
 
 	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/events"
+	"github.com/containers/podman-bootc/pkg/utils"
 
 	"github.com/sirupsen/logrus"
 	"libvirt.org/go/libvirt"
@@ -19,15 +24,163 @@ import (
 //go:embed domain-template.xml
 var domainTemplate string
 
+// SSHHostKeyInjected is set when the VMs get the SSH host key generated on the host
+const SSHHostKeyInjected = true
+
+// domainArch describes the architecture specific parts of the libvirt domain
+type domainArch struct {
+	machine   string
+	efi       bool
+	bios      bool
+	netDevice string
+	tpmModel  string
+	// tpm12 tells whether the TPM model supports TPM 1.2, all of them support TPM 2.0
+	tpm12    bool
+	cdromBus string
+	// panicModel is the model of the device reporting guest crashes to libvirt
+	panicModel string
+	// secureBoot overrides the domain settings to support Secure Boot, nil when it isn't supported
+	secureBoot *secureBootArch
+}
+
+type secureBootArch struct {
+	machine   string
+	netDevice string
+	smm       bool
+}
+
+var domainArchs = map[string]domainArch{
+	"x86_64": {
+		efi:        true,
+		bios:       true,
+		netDevice:  "virtio-net-pci,netdev=n0,bus=pci.0,addr=0x10",
+		tpmModel:   "tpm-tis",
+		tpm12:      true,
+		cdromBus:   "sata",
+		panicModel: "isa",
+		// The Secure Boot firmware requires SMM, only supported by the q35 machine
+		secureBoot: &secureBootArch{
+			machine:   "q35",
+			netDevice: "virtio-net-pci,netdev=n0,bus=pcie.0,addr=0x10",
+			smm:       true,
+		},
+	},
+	"aarch64": {
+		machine:    "virt",
+		efi:        true,
+		netDevice:  "virtio-net-pci,netdev=n0,bus=pcie.0,addr=0x10",
+		tpmModel:   "tpm-tis-device",
+		cdromBus:   "scsi",
+		panicModel: "pvpanic",
+		secureBoot: &secureBootArch{},
+	},
+	"s390x": {
+		machine:    "s390-ccw-virtio",
+		netDevice:  "virtio-net-ccw,netdev=n0",
+		cdromBus:   "scsi",
+		panicModel: "s390",
+	},
+	"ppc64le": {
+		machine:    "pseries",
+		netDevice:  "virtio-net-pci,netdev=n0,bus=pci.0,addr=0x10",
+		tpmModel:   "tpm-spapr",
+		cdromBus:   "scsi",
+		panicModel: "pseries",
+	},
+}
+
 type BootcVMLinux struct {
 	domain            *libvirt.Domain
 	libvirtUri        string
 	libvirtConnection *libvirt.Connect
+	activeDiskPath    string // qcow2 layer the running VM writes to
 	BootcVMCommon
 }
 
+// domainPrefix is the name prefix of the libvirt domains created by podman-bootc
+const domainPrefix = "podman-bootc-"
+
+// ValidateArch checks the architecture of the VM, the foreign ones are emulated
+func ValidateArch(arch string) error {
+	if arch == "" {
+		return nil
+	}
+	_, err := utils.OCIArch(arch)
+	return err
+}
+
 func vmName(id string) string {
-	return "podman-bootc-" + id[:12]
+	return domainPrefix + id[:12]
+}
+
+// ListDomainIDs returns the short image IDs of all the podman-bootc libvirt domains,
+// including the ones without a VM cache dir
+func ListDomainIDs(libvirtUri string) ([]string, error) {
+	conn, err := libvirt.NewConnect(libvirtUri)
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to libvirt: %w", err)
+	}
+	defer conn.Close()
+
+	domains, err := conn.ListAllDomains(libvirt.ConnectListAllDomainsFlags(0))
+	if err != nil {
+		return nil, fmt.Errorf("unable to list all domains: %w", err)
+	}
+
+	var ids []string
+	for _, domain := range domains {
+		name, err := domain.GetName()
+		domain.Free()
+		if err != nil {
+			return nil, err
+		}
+
+		if id, ok := strings.CutPrefix(name, domainPrefix); ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// RemoveDomain destroys and undefines the libvirt domain of a short image ID. It is
+// used for domains left behind without a VM cache dir, that NewVM can't load.
+func RemoveDomain(libvirtUri string, shortId string) error {
+	conn, err := libvirt.NewConnect(libvirtUri)
+	if err != nil {
+		return fmt.Errorf("unable to connect to libvirt: %w", err)
+	}
+	defer conn.Close()
+
+	domain, err := conn.LookupDomainByName(domainPrefix + shortId)
+	if err != nil {
+		if errors.Is(err, libvirt.ERR_NO_DOMAIN) {
+			return nil
+		}
+		return err
+	}
+	defer domain.Free()
+
+	active, err := domain.IsActive()
+	if err != nil {
+		return fmt.Errorf("unable to get VM state: %w", err)
+	}
+
+	if active {
+		if err := domain.Destroy(); err != nil {
+			return fmt.Errorf("unable to destroy VM: %w", err)
+		}
+	}
+
+	err = domain.UndefineFlags(libvirt.DOMAIN_UNDEFINE_NVRAM)
+	if errors.As(err, &libvirt.Error{Code: libvirt.ERR_INVALID_ARG}) {
+		err = domain.Undefine()
+	}
+	if err != nil {
+		return fmt.Errorf("unable to undefine VM: %w", err)
+	}
+
+	return nil
 }
 
 func NewVM(params NewVMParameters) (vm *BootcVMLinux, err error) {
@@ -78,10 +231,11 @@ func (v *BootcVMLinux) GetConfig() (cfg *BootcVMConfig, err error) {
 		return
 	}
 
-	cfg.Running, err = v.IsRunning()
+	cfg.State, err = v.State()
 	if err != nil {
 		return
 	}
+	cfg.Running = cfg.State == StateRunning || cfg.State == StatePaused
 
 	return
 }
@@ -113,7 +267,9 @@ func (v *BootcVMLinux) PrintConsole() (err error) {
 	return
 }
 
-func (v *BootcVMLinux) Run(params RunVMParameters) (err error) {
+// Run defines and starts the libvirt domain. If it fails, or ctx is cancelled,
+// before the VM is running the domain is destroyed and undefined.
+func (v *BootcVMLinux) Run(ctx context.Context, params RunVMParameters) (err error) {
 	v.sshPort = params.SSHPort
 	v.removeVm = params.RemoveVm
 	v.background = params.Background
@@ -122,20 +278,35 @@ func (v *BootcVMLinux) Run(params RunVMParameters) (err error) {
 	v.cloudInitDir = params.CloudInitDir
 	v.vmUsername = params.VMUser
 	v.sshIdentity = params.SSHIdentity
+	v.arch = params.Arch
+	if v.arch == "" {
+		v.arch = utils.HostArch()
+	}
+	v.firmware = params.Firmware
+	v.enrollKeysDir = params.EnrollKeysDir
+	v.tpm = params.Tpm
+	v.restart = params.Restart
+	if v.restart == "" {
+		v.restart = RestartNo
+	}
+	v.vsock = params.Vsock
 
 	if v.domain != nil {
-		isRunning, err := v.IsRunning()
+		state, err := v.State()
 		if err != nil {
 			return fmt.Errorf("unable to check if VM is running: %w", err)
 		}
 
-		if !isRunning {
+		switch state {
+		case StateStopped:
 			logrus.Debugf("Deleting stopped VM %s\n", v.imageID)
 			err = v.Delete()
 			if err != nil {
 				return fmt.Errorf("unable to delete stopped VM: %w", err)
 			}
-		} else {
+		case StateSaved:
+			return errors.New("VM is saved, restore it or stop it to discard its saved state")
+		default:
 			return errors.New("VM is already running")
 		}
 	}
@@ -143,6 +314,11 @@ func (v *BootcVMLinux) Run(params RunVMParameters) (err error) {
 	//domain doesn't exist, create it
 	logrus.Debugf("Creating VM %s\n", v.imageID)
 
+	err = v.prepareActiveDisk()
+	if err != nil {
+		return fmt.Errorf("unable to prepare the VM disk: %w", err)
+	}
+
 	domainXML, err := v.parseDomainTemplate()
 	if err != nil {
 		return fmt.Errorf("unable to parse domain template: %w", err)
@@ -150,24 +326,79 @@ func (v *BootcVMLinux) Run(params RunVMParameters) (err error) {
 
 	logrus.Debugf("domainXML: %s", domainXML)
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	v.domain, err = v.libvirtConnection.DomainDefineXMLFlags(domainXML, libvirt.DOMAIN_DEFINE_VALIDATE)
 	if err != nil {
 		return fmt.Errorf("unable to define virtual machine domain: %w", err)
 	}
 
+	defer func() {
+		if err == nil {
+			return
+		}
+		logrus.Debugf("Rolling back VM %s\n", v.imageID)
+		if err := v.Delete(); err != nil {
+			logrus.Errorf("unable to remove VM %s: %v", v.vmName, err)
+		}
+	}()
+
+	if v.enrollKeysDir != "" {
+		err = v.enrollSecureBootKeys()
+		if err != nil {
+			return fmt.Errorf("unable to enroll Secure Boot keys: %w", err)
+		}
+	}
+
+	// libvirt starts the domain again when its daemon starts, e.g. after the host rebooted
+	if v.restart == RestartAlways {
+		err = v.domain.SetAutostart(true)
+		if err != nil {
+			return fmt.Errorf("unable to set the VM autostart: %w", err)
+		}
+	}
+
 	err = v.domain.Create()
 	if err != nil {
 		return fmt.Errorf("unable to start virtual machine domain: %w", err)
 	}
 
-	err = v.waitForVMToBeRunning()
+	err = v.waitForVMToBeRunning(ctx)
 	if err != nil {
 		return fmt.Errorf("unable to wait for VM to be running: %w", err)
 	}
 
+	events.Record(v.user, v.imageID, events.Start, "")
 	return
 }
 
+// Start runs the stopped VM again in the background, restoring it if it is saved
+func (v *BootcVMLinux) Start(ctx context.Context) error {
+	state, err := v.State()
+	if err != nil {
+		return fmt.Errorf("unable to get the VM state: %w", err)
+	}
+
+	switch state {
+	case StateSaved:
+		return v.Restore()
+	case StateRunning, StatePaused:
+		return errors.New("VM is already running")
+	}
+
+	params, err := v.startParameters()
+	if err != nil {
+		return err
+	}
+
+	if err := v.Run(ctx, params); err != nil {
+		return err
+	}
+	return v.setConfigSshPort(params.SSHPort)
+}
+
 func (v *BootcVMLinux) parseDomainTemplate() (domainXML string, err error) {
 	tmpl, err := template.New("domain-template").Parse(domainTemplate)
 	if err != nil {
@@ -181,29 +412,148 @@ func (v *BootcVMLinux) parseDomainTemplate() (domainXML string, err error) {
 		Port            string
 		PIDFile         string
 		SMBios          string
+		Credentials     string
 		Name            string
 		CloudInitCDRom  string
 		CloudInitSMBios string
+		DomainType      string
+		CPUMode         string
+		Arch            string
+		Machine         string
+		EFI             bool
+		SecureBoot      bool
+		EnrolledKeys    bool
+		RawFirmware     bool
+		SMM             bool
+		NVRAMPath       string
+		NetDevice       string
+		TPMModel        string
+		TPMVersion      string
+		TPMStatePath    string
+		OnPoweroff      string
+		OnCrash         string
+		PanicModel      string
+		VsockCID        uint32
+	}
+
+	arch, ok := domainArchs[v.arch]
+	if !ok {
+		return "", fmt.Errorf("unsupported VM architecture %q", v.arch)
 	}
 
 	templateParams := TemplateParams{
-		DiskImagePath: v.diskImagePath,
+		DiskImagePath: v.activeDiskPath,
 		Port:          strconv.Itoa(v.sshPort),
 		PIDFile:       v.pidFile,
 		Name:          v.vmName,
+		DomainType:    "kvm",
+		CPUMode:       "host-model",
+		Arch:          v.arch,
+		Machine:       arch.machine,
+		EFI:           arch.efi,
+		NetDevice:     arch.netDevice,
+		TPMModel:      arch.tpmModel,
+		OnPoweroff:    "destroy",
+		OnCrash:       "destroy",
+	}
+
+	switch v.restart {
+	case RestartAlways:
+		templateParams.OnPoweroff = "restart"
+		fallthrough
+	case RestartOnFailure:
+		templateParams.OnCrash = "restart"
+		templateParams.PanicModel = arch.panicModel
+	}
+
+	if v.firmware == "" && arch.efi {
+		v.firmware = FirmwareEFI
+	}
+
+	switch v.firmware {
+	case FirmwareBIOS:
+		if !arch.bios {
+			return "", fmt.Errorf("the %s firmware is not supported on %s", v.firmware, v.arch)
+		}
+		templateParams.EFI = false
+	case FirmwareEFI, FirmwareEFISecureBoot:
+		if !arch.efi {
+			return "", fmt.Errorf("the %s firmware is not supported on %s", v.firmware, v.arch)
+		}
+		templateParams.EFI = true
+		templateParams.NVRAMPath = v.nvramPath()
+	}
+
+	if v.firmware == FirmwareEFISecureBoot {
+		if arch.secureBoot == nil {
+			return "", fmt.Errorf("the %s firmware is not supported on %s", v.firmware, v.arch)
+		}
+		templateParams.SecureBoot = true
+		// Custom keys are enrolled in a firmware without keys, it must be raw for virt-fw-vars
+		templateParams.EnrolledKeys = v.enrollKeysDir == ""
+		templateParams.RawFirmware = v.enrollKeysDir != ""
+		templateParams.SMM = arch.secureBoot.smm
+		if arch.secureBoot.machine != "" {
+			templateParams.Machine = arch.secureBoot.machine
+			templateParams.NetDevice = arch.secureBoot.netDevice
+		}
+	}
+
+	if v.tpm == "" {
+		v.tpm = TPM20
+		if arch.tpmModel == "" {
+			v.tpm = TPMNone
+		}
+	}
+
+	switch v.tpm {
+	case TPMNone:
+		templateParams.TPMModel = ""
+	case TPM12, TPM20:
+		if arch.tpmModel == "" || (v.tpm == TPM12 && !arch.tpm12) {
+			return "", fmt.Errorf("TPM %s is not supported on %s", v.tpm, v.arch)
+		}
+		templateParams.TPMVersion = v.tpm
+		// The TPM state is kept in the VM cache dir, so it survives the domain
+		templateParams.TPMStatePath = filepath.Join(v.cacheDir, config.TPMStateDir)
+	}
+
+	// Foreign architectures can't use KVM, so they are emulated by TCG
+	if v.arch != utils.HostArch() {
+		logrus.Debugf("Emulating %s VM on %s host", v.arch, utils.HostArch())
+		templateParams.DomainType = "qemu"
+		templateParams.CPUMode = "maximum"
+	}
+
+	if v.vsock {
+		templateParams.VsockCID = v.vsockCID()
 	}
 
 	if v.sshIdentity != "" {
-		smbiosCmd, err := v.oemString()
+		smbiosCmds, err := v.oemStrings()
 		if err != nil {
 			return domainXML, fmt.Errorf("unable to get OEM string: %w", err)
 		}
 
 		//this is gross but it's probably better than parsing the XML
-		templateParams.SMBios = fmt.Sprintf(`
+		for _, smbiosCmd := range smbiosCmds {
+			templateParams.SMBios += fmt.Sprintf(`
 			<qemu:arg value='-smbios'/>
 			<qemu:arg value='%s'/>
 		`, smbiosCmd)
+		}
+	}
+
+	credentials, err := v.fileCredentials()
+	if err != nil {
+		return "", fmt.Errorf("unable to get the credentials: %w", err)
+	}
+	for _, credential := range credentials {
+		// systemd imports the credentials of the opt/io.systemd.credentials fw_cfg directory
+		templateParams.Credentials += fmt.Sprintf(`
+			<qemu:arg value='-fw_cfg'/>
+			<qemu:arg value='name=opt/io.systemd.credentials/%s,file=%s'/>
+		`, credential.name, strings.ReplaceAll(credential.path, ",", ",,"))
 	}
 
 	err = v.ParseCloudInit()
@@ -216,10 +566,10 @@ func (v *BootcVMLinux) parseDomainTemplate() (domainXML string, err error) {
 			<disk type="file" device="cdrom">
 				<driver name="qemu" type="raw"/>
 				<source file="%s"></source>
-				<target dev="sda" bus="sata"/>
+				<target dev="sda" bus="%s"/>
 				<readonly/>
 			</disk>
-		`, v.cloudInitArgs)
+		`, v.cloudInitArgs, arch.cdromBus)
 	}
 
 	err = tmpl.Execute(&domainXMLBuf, templateParams)
@@ -230,7 +580,7 @@ func (v *BootcVMLinux) parseDomainTemplate() (domainXML string, err error) {
 	return domainXMLBuf.String(), nil
 }
 
-func (v *BootcVMLinux) waitForVMToBeRunning() error {
+func (v *BootcVMLinux) waitForVMToBeRunning(ctx context.Context) error {
 	timeout := 60 * time.Second
 	elapsed := 0 * time.Second
 
@@ -245,7 +595,9 @@ func (v *BootcVMLinux) waitForVMToBeRunning() error {
 			return nil
 		}
 
-		time.Sleep(1 * time.Second)
+		if err := utils.SleepWithContext(ctx, 1*time.Second); err != nil {
+			return err
+		}
 		elapsed += 1 * time.Second
 	}
 
@@ -274,14 +626,47 @@ func (v *BootcVMLinux) loadExistingDomain() (err error) {
 	if err != nil {
 		if errors.Is(err, libvirt.ERR_NO_DOMAIN) {
 			logrus.Debugf("VM %s not found", name) // allow for domain not found
-		} else {
-			return
+			return nil
 		}
+		return
 	}
 
+	v.recordGuestStop()
 	return nil
 }
 
+// recordGuestStop records the crash or the shutdown of the guest, podman-bootc only records
+// the stops it drives. It is recorded when the domain is loaded after the VM stopped, if
+// the last recorded event of the VM is a start.
+func (v *BootcVMLinux) recordGuestStop() {
+	state, reason, err := v.domain.GetState()
+	if err != nil {
+		logrus.Debugf("unable to get VM state: %v", err)
+		return
+	}
+
+	var status, detail string
+	switch {
+	case state == libvirt.DOMAIN_CRASHED:
+		status = events.Crash
+	case state == libvirt.DOMAIN_SHUTOFF && libvirt.DomainShutoffReason(reason) == libvirt.DOMAIN_SHUTOFF_CRASHED:
+		status = events.Crash
+	case state == libvirt.DOMAIN_SHUTOFF && libvirt.DomainShutoffReason(reason) == libvirt.DOMAIN_SHUTOFF_SHUTDOWN:
+		status, detail = events.Stop, "shutdown"
+	default:
+		return
+	}
+
+	last, found, err := events.Last(v.user, v.imageID, events.Start, events.Stop, events.Crash)
+	if err != nil {
+		logrus.Debugf("unable to read the event log: %v", err)
+		return
+	}
+	if found && last.Status == events.Start {
+		events.Record(v.user, v.imageID, status, detail)
+	}
+}
+
 // Delete the VM definition
 func (v *BootcVMLinux) Delete() (err error) {
 	err = v.Shutdown()
@@ -295,7 +680,8 @@ func (v *BootcVMLinux) Delete() (err error) {
 	}
 
 	if domainExists {
-		err = v.domain.UndefineFlags(libvirt.DOMAIN_UNDEFINE_NVRAM)
+		// The NVRAM and the TPM state are in the VM cache dir, they are kept until the VM is removed
+		err = v.domain.UndefineFlags(libvirt.DOMAIN_UNDEFINE_KEEP_NVRAM | libvirt.DOMAIN_UNDEFINE_KEEP_TPM)
 		if errors.As(err, &libvirt.Error{Code: libvirt.ERR_INVALID_ARG}) {
 			err = v.domain.Undefine()
 		}
@@ -305,6 +691,17 @@ func (v *BootcVMLinux) Delete() (err error) {
 		}
 	}
 
+	err = os.Remove(v.savedStatePath())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to remove the saved VM state: %w", err)
+	}
+
+	// The changes since the VM started are discarded, unless a snapshot was created
+	err = v.discardActiveDisk()
+	if err != nil {
+		return fmt.Errorf("unable to discard the VM disk changes: %w", err)
+	}
+
 	return
 }
 
@@ -321,6 +718,7 @@ func (v *BootcVMLinux) Shutdown() (err error) {
 		if err != nil {
 			return fmt.Errorf("unable to destroy VM: %w", err)
 		}
+		events.Record(v.user, v.imageID, events.Stop, "destroyed")
 	}
 
 	return
@@ -346,21 +744,126 @@ func (v *BootcVMLinux) Exists() (bool, error) {
 	return false, nil
 }
 
+// IsRunning reports whether the VM is running or paused
 func (v *BootcVMLinux) IsRunning() (exists bool, err error) {
+	state, err := v.State()
+	if err != nil {
+		return false, err
+	}
+
+	return state == StateRunning || state == StatePaused, nil
+}
+
+// State returns the state of the VM, one of the State* values
+func (v *BootcVMLinux) State() (string, error) {
 	if v.domain == nil { // domain hasn't been created yet
-		return false, nil
+		return StateStopped, nil
 	}
 
 	state, _, err := v.domain.GetState()
 	if err != nil {
-		return false, fmt.Errorf("unable to get VM state: %w", err)
+		return "", fmt.Errorf("unable to get VM state: %w", err)
 	}
 
-	if state == libvirt.DOMAIN_RUNNING {
-		return true, nil
-	} else {
-		return false, nil
+	switch state {
+	case libvirt.DOMAIN_RUNNING:
+		return StateRunning, nil
+	case libvirt.DOMAIN_PAUSED:
+		return StatePaused, nil
 	}
+
+	saved, err := utils.FileExists(v.savedStatePath())
+	if err != nil {
+		return "", err
+	}
+	if saved {
+		return StateSaved, nil
+	}
+
+	return StateStopped, nil
+}
+
+// Pause suspends the VM, it keeps its memory but doesn't use any CPU
+func (v *BootcVMLinux) Pause() error {
+	if err := v.expectState(StateRunning); err != nil {
+		return err
+	}
+
+	if err := v.domain.Suspend(); err != nil {
+		return fmt.Errorf("unable to pause VM: %w", err)
+	}
+	events.Record(v.user, v.imageID, events.Pause, "")
+	return nil
+}
+
+// Unpause resumes a paused VM
+func (v *BootcVMLinux) Unpause() error {
+	if err := v.expectState(StatePaused); err != nil {
+		return err
+	}
+
+	if err := v.domain.Resume(); err != nil {
+		return fmt.Errorf("unable to unpause VM: %w", err)
+	}
+	events.Record(v.user, v.imageID, events.Unpause, "")
+	return nil
+}
+
+// Save stops the VM after saving its memory state to the VM cache dir, a paused VM
+// is paused again when restored
+func (v *BootcVMLinux) Save() error {
+	state, err := v.State()
+	if err != nil {
+		return err
+	}
+
+	var flags libvirt.DomainSaveRestoreFlags
+	switch state {
+	case StateRunning:
+	case StatePaused:
+		flags = libvirt.DOMAIN_SAVE_PAUSED
+	default:
+		return fmt.Errorf("VM is %s, only a running or paused VM can be saved", state)
+	}
+
+	if err := v.domain.SaveFlags(v.savedStatePath(), "", flags); err != nil {
+		return fmt.Errorf("unable to save VM: %w", err)
+	}
+	events.Record(v.user, v.imageID, events.Stop, "saved")
+	return nil
+}
+
+// Restore starts a saved VM from its memory state, the saved state is then removed
+func (v *BootcVMLinux) Restore() error {
+	if err := v.expectState(StateSaved); err != nil {
+		return err
+	}
+
+	if err := v.libvirtConnection.DomainRestoreFlags(v.savedStatePath(), "", 0); err != nil {
+		return fmt.Errorf("unable to restore VM: %w", err)
+	}
+	events.Record(v.user, v.imageID, events.Start, "restored")
+
+	if err := os.Remove(v.savedStatePath()); err != nil {
+		logrus.Warningf("unable to remove the saved VM state: %v", err)
+	}
+	return nil
+}
+
+func (v *BootcVMLinux) expectState(expected string) error {
+	state, err := v.State()
+	if err != nil {
+		return err
+	}
+
+	if state != expected {
+		return fmt.Errorf("VM is %s, not %s", state, expected)
+	}
+	return nil
+}
+
+func (v *BootcVMLinux) savedStatePath() string {
+	return filepath.Join(v.cacheDir, config.SavedStateFile)
 }
 
 func (v *BootcVMLinux) Unlock() error {
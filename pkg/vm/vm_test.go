@@ -92,8 +92,16 @@ func createTestVM(imageId string) (bootcVM *vm.BootcVMLinux) {
 	return
 }
 
+// ignoreDiskUsage clears the disk usage of the listed VMs, it depends on the filesystem
+func ignoreDiskUsage(vmList []vm.BootcVMConfig) {
+	for i := range vmList {
+		Expect(vmList[i].DiskUsage).To(Not(BeEmpty()))
+		vmList[i].DiskUsage = ""
+	}
+}
+
 func runTestVM(bootcVM vm.BootcVM) {
-	err := bootcVM.Run(vm.RunVMParameters{
+	err := bootcVM.Run(context.Background(), vm.RunVMParameters{
 		VMUser:        "root",
 		CloudInitDir:  "",
 		CloudInitData: false,
@@ -221,20 +229,63 @@ var _ = Describe("VM", func() {
 			runTestVM(bootcVM)
 			vmList, err := cmd.CollectVmList(testUser, testLibvirtUri)
 			Expect(err).To(Not(HaveOccurred()))
+			ignoreDiskUsage(vmList)
 
 			Expect(vmList).To(HaveLen(1))
 			Expect(vmList[0]).To(Equal(vm.BootcVMConfig{
 				Id:          testImageID[:12],
 				SshPort:     22,
 				SshIdentity: testUserSSHKey,
+				SshUser:     "root",
 				RepoTag:     testRepoTag,
 				Created:     "About a minute ago",
 				DiskSize:    "0B",
 				Running:     true,
+				State:       vm.StateRunning,
+				Firmware:    vm.FirmwareEFI,
+				Tpm:         vm.TPM20,
+				Restart:     vm.RestartNo,
+				Arch:        utils.HostArch(),
 			}))
 		})
 	})
 
+	Context("is in use", func() {
+		It("should fail when the lock timeout expires", func() {
+			bootcVM := createTestVM(testImageID)
+			defer func() {
+				_ = bootcVM.Unlock()
+			}()
+
+			_, err := vm.NewVM(vm.NewVMParameters{
+				ImageID:     testImageID,
+				User:        testUser,
+				LibvirtUri:  testLibvirtUri,
+				Locking:     utils.Exclusive,
+				LockTimeout: 500 * time.Millisecond,
+			})
+			Expect(err).To(MatchError(vm.ErrVMInUse))
+		})
+
+		It("should wait for the VM to be released", func() {
+			bootcVM := createTestVM(testImageID)
+			go func() {
+				time.Sleep(500 * time.Millisecond)
+				_ = bootcVM.Unlock()
+			}()
+
+			bootcVM2, err := vm.NewVM(vm.NewVMParameters{
+				ImageID:     testImageID,
+				User:        testUser,
+				LibvirtUri:  testLibvirtUri,
+				Locking:     utils.Exclusive,
+				LockTimeout: 1 * time.Minute,
+			})
+			Expect(err).To(Not(HaveOccurred()))
+			_ = bootcVM2.Unlock()
+		})
+	})
+
 	Context("multiple running", func() {
 		It("should list all VMs", func() {
 			bootcVM := createTestVM(testImageID)
@@ -262,36 +313,55 @@ var _ = Describe("VM", func() {
 
 			vmList, err := cmd.CollectVmList(testUser, testLibvirtUri)
 			Expect(err).To(Not(HaveOccurred()))
+			ignoreDiskUsage(vmList)
 
 			Expect(vmList).To(HaveLen(3))
 			Expect(vmList).To(ContainElement(vm.BootcVMConfig{
 				Id:          testImageID[:12],
 				SshPort:     22,
 				SshIdentity: testUserSSHKey,
+				SshUser:     "root",
 				RepoTag:     testRepoTag,
 				Created:     "About a minute ago",
 				DiskSize:    "0B",
 				Running:     true,
+				State:       vm.StateRunning,
+				Firmware:    vm.FirmwareEFI,
+				Tpm:         vm.TPM20,
+				Restart:     vm.RestartNo,
+				Arch:        utils.HostArch(),
 			}))
 
 			Expect(vmList).To(ContainElement(vm.BootcVMConfig{
 				Id:          id2[:12],
 				SshPort:     22,
 				SshIdentity: testUserSSHKey,
+				SshUser:     "root",
 				RepoTag:     testRepoTag,
 				Created:     "About a minute ago",
 				DiskSize:    "0B",
 				Running:     true,
+				State:       vm.StateRunning,
+				Firmware:    vm.FirmwareEFI,
+				Tpm:         vm.TPM20,
+				Restart:     vm.RestartNo,
+				Arch:        utils.HostArch(),
 			}))
 
 			Expect(vmList).To(ContainElement(vm.BootcVMConfig{
 				Id:          id3[:12],
 				SshPort:     22,
 				SshIdentity: testUserSSHKey,
+				SshUser:     "root",
 				RepoTag:     testRepoTag,
 				Created:     "About a minute ago",
 				DiskSize:    "0B",
 				Running:     true,
+				State:       vm.StateRunning,
+				Firmware:    vm.FirmwareEFI,
+				Tpm:         vm.TPM20,
+				Restart:     vm.RestartNo,
+				Arch:        utils.HostArch(),
 			}))
 		})
 	})
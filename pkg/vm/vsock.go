@@ -0,0 +1,388 @@
+package vm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/containers/podman-bootc/pkg/config"
+	"github.com/containers/podman-bootc/pkg/utils"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/term"
+)
+
+// vsockPort is the port of the guest vsock shell
+const vsockPort = 22022
+
+// vsockShellUnit is the socket unit of the guest vsock shell, each connection runs an
+// instance of vsockShellService
+const vsockShellUnit = `[Unit]
+Description=podman-bootc vsock shell socket
+
+[Socket]
+ListenStream=vsock::%d
+Accept=yes
+`
+
+const vsockShellService = `[Unit]
+Description=podman-bootc vsock shell
+
+[Service]
+ImportCredential=podman-bootc.vsock-*
+ExecStart=/bin/bash %d/podman-bootc.vsock-shell
+StandardInput=socket
+StandardError=socket
+`
+
+// vsockShellScript runs the command of a connection as the VM user. The connection starts
+// with a header line: the VM token, the trailer boundary, the mode (tty, pipe or resize), the
+// terminal rows, columns and type, and the base64 encoded command, - for a login shell. The
+// output of the command, with its standard error in pipe mode, ends with the trailer: the
+// boundary followed by the exit code. A resize connection sets the terminal size of the
+// tty session with the same boundary.
+const vsockShellScript = `read -r token boundary mode rows cols term command || exit 1
+[ "$token" = "$(cat "$CREDENTIALS_DIRECTORY/podman-bootc.vsock-token")" ] || exit 1
+[[ "$boundary" =~ ^[a-z0-9-]+:$ && "$rows" =~ ^[0-9]+$ && "$cols" =~ ^[0-9]+$ ]] || exit 1
+user=$(cat "$CREDENTIALS_DIRECTORY/podman-bootc.vsock-user") || exit 1
+
+# the terminal of each tty session, by boundary
+ttyfile=/run/podman-bootc-vsock/${boundary%:}
+if [ "$mode" = resize ]; then
+	exec stty -F "$(cat "$ttyfile")" rows "$rows" cols "$cols"
+fi
+
+export TERM="$term"
+args=(runuser -l "$user")
+if [ "$command" != - ]; then
+	command=$(printf %s "$command" | base64 -d) || exit 1
+	args+=(-c "$command")
+fi
+
+if [ "$mode" = tty ]; then
+	mkdir -p -m 0700 /run/podman-bootc-vsock
+	script -qefc "tty > $ttyfile; stty rows $rows cols $cols; exec $(printf '%q ' "${args[@]}")" /dev/null
+	status=$?
+	rm -f "$ttyfile"
+else
+	"${args[@]}" 2>&1
+	status=$?
+fi
+printf '%s%d\n' "$boundary" "$status"
+`
+
+// vsockTokenCredential is the credential of the token, passed from the file of the VM cache dir
+const vsockTokenCredential = "podman-bootc.vsock-token"
+
+// vsockConn is a vsock connection to the VM
+type vsockConn interface {
+	io.ReadWriteCloser
+	CloseWrite() error
+}
+
+// vsockCID returns the vsock context ID of the VM, stable across its runs. It is derived
+// from the VM cache dir so the VMs of different users don't conflict. Guest CIDs start at 3.
+func (v *BootcVMCommon) vsockCID() uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(v.cacheDir))
+	return 3 + h.Sum32()%(0xfffffffe-3)
+}
+
+// vsockToken returns the token authenticating the connections to the guest vsock shell,
+// creating it when create is set
+func (v *BootcVMCommon) vsockToken(create bool) (string, error) {
+	tokenFile := filepath.Join(v.cacheDir, config.VsockTokenFile)
+	token, err := os.ReadFile(tokenFile)
+	if err == nil || !errors.Is(err, os.ErrNotExist) || !create {
+		return strings.TrimSpace(string(token)), err
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	token = []byte(hex.EncodeToString(random))
+	if err := os.WriteFile(tokenFile, token, 0600); err != nil {
+		return "", fmt.Errorf("unable to write the vsock token: %w", err)
+	}
+	return string(token), nil
+}
+
+// oemStringsVsockShell returns the systemd credentials installing the guest vsock shell, the
+// token is passed from a file. The units are created by systemd-debug-generator, which
+// requires systemd 256.
+func oemStringsVsockShell(user string) []string {
+	credentials := []struct {
+		name  string
+		value string
+	}{
+		{"podman-bootc.vsock-user", user},
+		{"podman-bootc.vsock-shell", vsockShellScript},
+		{"systemd.extra-unit.podman-bootc-vsock.socket", fmt.Sprintf(vsockShellUnit, vsockPort)},
+		{"systemd.extra-unit.podman-bootc-vsock@.service", vsockShellService},
+		{"systemd.unit-dropin.sockets.target~podman-bootc", "[Unit]\nWants=podman-bootc-vsock.socket\n"},
+	}
+
+	var oemStrings []string
+	for _, c := range credentials {
+		oemStrings = append(oemStrings, fmt.Sprintf("io.systemd.credential.binary:%s=%s", c.name, base64.StdEncoding.EncodeToString([]byte(c.value))))
+	}
+	return oemStrings
+}
+
+// Modes of the vsock shell connections
+const (
+	vsockModePipe   = "pipe"
+	vsockModeTTY    = "tty"
+	vsockModeResize = "resize"
+)
+
+// newVsockBoundary returns a random trailer boundary, it also identifies a tty session
+func newVsockBoundary() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	return "podman-bootc-exit-" + hex.EncodeToString(random) + ":", nil
+}
+
+// dialVsockShell connects to the guest vsock shell, and sends the header running command
+func (v *BootcVMCommon) dialVsockShell(boundary, mode string, command []string, termType string, rows, cols int) (vsockConn, error) {
+	token, err := v.vsockToken(false)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the vsock token: %w", err)
+	}
+
+	conn, err := dialVsock(v.vsockCID(), vsockPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the vsock shell: %w", err)
+	}
+
+	if termType == "" {
+		termType = "dumb"
+	}
+	encoded := "-"
+	if len(command) > 0 {
+		// the command is run by the user shell, as ssh does
+		encoded = base64.StdEncoding.EncodeToString([]byte(strings.Join(command, " ")))
+	}
+
+	header := fmt.Sprintf("%s %s %s %d %d %s %s\n", token, boundary, mode, rows, cols, termType, encoded)
+	if _, err := conn.Write([]byte(header)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to send the command to the vsock shell: %w", err)
+	}
+
+	return conn, nil
+}
+
+// resizeVsockShell sets the terminal size of the tty session with the boundary
+func (v *BootcVMCommon) resizeVsockShell(boundary string, rows, cols int) error {
+	conn, err := v.dialVsockShell(boundary, vsockModeResize, nil, "", rows, cols)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.CloseWrite(); err != nil {
+		return err
+	}
+	// the connection is closed once the size is set
+	_, err = io.Copy(io.Discard, conn)
+	return err
+}
+
+// forwardVsockWindowSize sets the terminal size of the tty session whenever it changes
+func (v *BootcVMCommon) forwardVsockWindowSize(boundary string, fd int) (stop func()) {
+	winch := make(chan os.Signal, 1)
+	signal.Notify(winch, syscall.SIGWINCH)
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-winch:
+				cols, rows, err := term.GetSize(fd)
+				if err != nil {
+					logrus.Debugf("unable to get the terminal size: %v", err)
+					continue
+				}
+				if err := v.resizeVsockShell(boundary, rows, cols); err != nil {
+					logrus.Debugf("unable to change the window size: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(winch)
+		close(done)
+	}
+}
+
+// copyVsockOutput copies the command output to out and returns its exit code, read from
+// the trailer ending the output
+func copyVsockOutput(out io.Writer, conn io.Reader, boundary string) (int, error) {
+	// the trailer is held back until the connection is closed
+	holdBack := len(boundary) + len("-2147483648\n")
+	var pending []byte
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := conn.Read(buf)
+		pending = append(pending, buf[:n]...)
+		if len(pending) > holdBack {
+			if _, err := out.Write(pending[:len(pending)-holdBack]); err != nil {
+				return 0, err
+			}
+			pending = append(pending[:0], pending[len(pending)-holdBack:]...)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	i := bytes.LastIndex(pending, []byte(boundary))
+	if i < 0 || !bytes.HasSuffix(pending, []byte("\n")) {
+		if _, err := out.Write(pending); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("the vsock shell connection was closed before the command exited")
+	}
+
+	exitCode, err := strconv.Atoi(string(pending[i+len(boundary) : len(pending)-1]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid vsock shell exit code: %w", err)
+	}
+
+	_, err = out.Write(pending[:i])
+	return exitCode, err
+}
+
+// runVsock runs a command over vsock or starts an interactive shell if no command is
+// provided. The connection carries a single stream, so the standard error of a command is
+// merged in its standard output. The terminal size of a shell is set over new connections.
+func (v *BootcVMCommon) runVsock(ctx context.Context, command []string) error {
+	stdinFd := int(os.Stdin.Fd())
+	tty := len(command) == 0 && term.IsTerminal(stdinFd)
+
+	mode := vsockModePipe
+	rows, cols := 0, 0
+	if tty {
+		mode = vsockModeTTY
+		var err error
+		cols, rows, err = term.GetSize(stdinFd)
+		if err != nil {
+			return fmt.Errorf("unable to get the terminal size: %w", err)
+		}
+	}
+
+	boundary, err := newVsockBoundary()
+	if err != nil {
+		return err
+	}
+	conn, err := v.dialVsockShell(boundary, mode, command, os.Getenv("TERM"), rows, cols)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if tty {
+		fmt.Printf("Connecting to vm %s. To close the connection, use `exit`\n", v.imageID)
+		state, err := term.MakeRaw(stdinFd)
+		if err != nil {
+			return fmt.Errorf("unable to set the terminal in raw mode: %w", err)
+		}
+		defer func() {
+			if err := term.Restore(stdinFd, state); err != nil {
+				logrus.Warningf("unable to restore the terminal: %v", err)
+			}
+		}()
+
+		stopResize := v.forwardVsockWindowSize(boundary, stdinFd)
+		defer stopResize()
+	}
+
+	go func() {
+		if _, err := io.Copy(conn, os.Stdin); err != nil {
+			logrus.Debugf("vsock shell input: %v", err)
+		}
+		if err := conn.CloseWrite(); err != nil {
+			logrus.Debugf("vsock shell input: %v", err)
+		}
+	}()
+
+	exitCode, err := copyVsockOutput(os.Stdout, conn, boundary)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return &utils.ExitCodeError{Code: exitCode}
+	}
+	return nil
+}
+
+// vsockCommandOutput runs a command over vsock without input, and returns its output and
+// exit code. Cancelling ctx closes the connection.
+func (v *BootcVMCommon) vsockCommandOutput(ctx context.Context, command string) ([]byte, int, error) {
+	boundary, err := newVsockBoundary()
+	if err != nil {
+		return nil, 0, err
+	}
+	conn, err := v.dialVsockShell(boundary, vsockModePipe, []string{command}, "", 0, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if err := conn.CloseWrite(); err != nil {
+		return nil, 0, err
+	}
+
+	var out bytes.Buffer
+	exitCode, err := copyVsockOutput(&out, conn, boundary)
+	return out.Bytes(), exitCode, err
+}
+
+// vsockOutput runs a command over vsock and returns its output
+func (v *BootcVMCommon) vsockOutput(command string) ([]byte, error) {
+	out, exitCode, err := v.vsockCommandOutput(context.Background(), command)
+	if err != nil {
+		return nil, err
+	}
+	if exitCode != 0 {
+		return nil, fmt.Errorf("%w: %s", &utils.ExitCodeError{Code: exitCode}, strings.TrimSpace(string(out)))
+	}
+	return out, nil
+}
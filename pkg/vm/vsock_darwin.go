@@ -0,0 +1,9 @@
+package vm
+
+import (
+	"errors"
+)
+
+func dialVsock(cid uint32, port uint32) (vsockConn, error) {
+	return nil, errors.New("vsock is not supported on macOS")
+}
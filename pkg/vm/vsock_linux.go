@@ -0,0 +1,50 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// vsockFile is a vsock connection, the net package doesn't support the vsock sockets
+type vsockFile struct {
+	*os.File
+}
+
+// dialVsock connects to a vsock port of a VM
+func dialVsock(cid uint32, port uint32) (vsockConn, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create a vsock socket: %w", err)
+	}
+
+	if err := unix.Connect(fd, &unix.SockaddrVM{CID: cid, Port: port}); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	// a non blocking file is handled by the runtime poller, so Close interrupts a Read
+	if err := unix.SetNonblock(fd, true); err != nil {
+		unix.Close(fd)
+		return nil, err
+	}
+
+	return &vsockFile{os.NewFile(uintptr(fd), fmt.Sprintf("vsock:%d:%d", cid, port))}, nil
+}
+
+func (f *vsockFile) CloseWrite() error {
+	raw, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var shutdownErr error
+	err = raw.Control(func(fd uintptr) {
+		shutdownErr = unix.Shutdown(int(fd), unix.SHUT_WR)
+	})
+	if err != nil {
+		return err
+	}
+	return shutdownErr
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package vm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing/iotest"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// chunkReader returns the chunks in turn, one per Read
+type chunkReader struct {
+	chunks []string
+	err    error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if r.chunks[0] == "" {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+var _ = Describe("copyVsockOutput", func() {
+	const boundary = "podman-bootc-exit-0123456789abcdef:"
+
+	DescribeTable("should copy the output and return the exit code",
+		func(chunks []string, output string, exitCode int) {
+			var out bytes.Buffer
+			code, err := copyVsockOutput(&out, &chunkReader{chunks: chunks, err: io.EOF}, boundary)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out.String()).To(Equal(output))
+			Expect(code).To(Equal(exitCode))
+		},
+		Entry("in a single read", []string{"hello\n" + boundary + "0\n"}, "hello\n", 0),
+		Entry("without output", []string{boundary + "3\n"}, "", 3),
+		Entry("with the output not ending with a newline", []string{"hello" + boundary + "1\n"}, "hello", 1),
+		Entry("with the trailer split across reads", []string{"hello\npodman-bootc", "-exit-0123456789", "abcdef:12", "7\n"}, "hello\n", 127),
+		Entry("with the exit code split from its newline", []string{"hello\n" + boundary + "42", "\n"}, "hello\n", 42),
+		Entry("with the trailer alone in the last read", []string{"hello\n", boundary + "2\n"}, "hello\n", 2),
+		Entry("with the boundary in the output", []string{boundary + "9\nhello\n" + boundary + "0\n"}, boundary+"9\nhello\n", 0),
+		Entry("with a negative exit code", []string{boundary + "-1\n"}, "", -1),
+	)
+
+	It("should handle reads of one byte", func() {
+		var out bytes.Buffer
+		code, err := copyVsockOutput(&out, iotest.OneByteReader(strings.NewReader("hello\n"+boundary+"5\n")), boundary)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(out.String()).To(Equal("hello\n"))
+		Expect(code).To(Equal(5))
+	})
+
+	It("should handle the exit code at a buffer boundary", func() {
+		// the first read fills the 32KiB buffer, the trailer starts before its end, or
+		// ends with it
+		trailer := boundary + "4\n"
+		for _, inFirstRead := range []int{0, 1, len(boundary) / 2, len(boundary), len(trailer) - 1, len(trailer)} {
+			output := strings.Repeat("x", 32*1024-inFirstRead)
+			var out bytes.Buffer
+			code, err := copyVsockOutput(&out, strings.NewReader(output+trailer), boundary)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(out.String()).To(Equal(output))
+			Expect(code).To(Equal(4))
+		}
+	})
+
+	DescribeTable("should fail when the connection is closed before the trailer",
+		func(data string, output string) {
+			var out bytes.Buffer
+			_, err := copyVsockOutput(&out, strings.NewReader(data), boundary)
+			Expect(err).To(MatchError(ContainSubstring("closed before the command exited")))
+			// the output received is not lost
+			Expect(out.String()).To(Equal(output))
+		},
+		Entry("without output", "", ""),
+		Entry("with output", "hello\n", "hello\n"),
+		Entry("with a partial boundary", "hello\npodman-bootc-exit-", "hello\npodman-bootc-exit-"),
+		Entry("without the exit code newline", "hello\n"+boundary+"0", "hello\n"+boundary+"0"),
+	)
+
+	It("should fail on an invalid exit code", func() {
+		_, err := copyVsockOutput(io.Discard, strings.NewReader(boundary+"abc\n"), boundary)
+		Expect(err).To(MatchError(ContainSubstring("invalid vsock shell exit code")))
+	})
+
+	It("should return the read errors", func() {
+		readErr := errors.New("connection reset")
+		_, err := copyVsockOutput(io.Discard, &chunkReader{chunks: []string{"hello\n"}, err: readErr}, boundary)
+		Expect(err).To(MatchError(readErr))
+	})
+})
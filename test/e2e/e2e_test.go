@@ -250,21 +250,21 @@ var _ = Describe("E2E", func() {
 			listOutput := e2e.ParseListOutput(stdout)
 			Expect(listOutput).To(HaveLen(3))
 			Expect(listOutput).To(ContainElement(e2e.ListEntry{
-				Id:      activeVM.Id,
-				Repo:    e2e.TestImageTwo,
-				Running: "true",
+				Id:    activeVM.Id,
+				Repo:  e2e.TestImageTwo,
+				State: "running",
 			}))
 
 			Expect(listOutput).To(ContainElement(e2e.ListEntry{
-				Id:      inactiveVM.Id,
-				Repo:    e2e.TestImageOne,
-				Running: "true",
+				Id:    inactiveVM.Id,
+				Repo:  e2e.TestImageOne,
+				State: "running",
 			}))
 
 			Expect(listOutput).To(ContainElement(e2e.ListEntry{
-				Id:      stoppedVM.Id,
-				Repo:    e2e.BaseImage,
-				Running: "false",
+				Id:    stoppedVM.Id,
+				Repo:  e2e.BaseImage,
+				State: "stopped",
 			}))
 		})
 
@@ -315,4 +315,107 @@ var _ = Describe("E2E", func() {
 			}
 		})
 	})
+
+	Context("Pull from a local registry", Ordered, func() {
+		BeforeAll(func() {
+			err := e2e.StartTestRegistry()
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		It("Should fail to pull a missing image with --pull never", func() {
+			_, _, err := e2e.RunPodmanBootc("pull", "--pull", "never", e2e.TestRegistryImageOne)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should fail to pull from a plain HTTP registry with TLS verification", func() {
+			_, _, err := e2e.RunPodmanBootc("pull", "--tls-verify=true", e2e.TestRegistryImageOne)
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("Should pull the image without TLS verification", func() {
+			stdout, _, err := e2e.RunPodmanBootc("pull", "--tls-verify=false", e2e.TestRegistryImageOne)
+			Expect(err).To(Not(HaveOccurred()))
+
+			vmId, err := e2e.GetVMIdFromContainerImage(e2e.TestRegistryImageOne)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(stdout).To(HavePrefix(vmId))
+		})
+
+		AfterAll(func() {
+			err := e2e.StopTestRegistry()
+			Expect(err).To(Not(HaveOccurred()))
+			err = e2e.Cleanup()
+			if err != nil {
+				Fail(err.Error())
+			}
+		})
+	})
+
+	Context("Verify image signatures", Ordered, func() {
+		var policy, registriesD string
+
+		BeforeAll(func() {
+			err := e2e.StartTestRegistry()
+			Expect(err).To(Not(HaveOccurred()))
+
+			keyDir, err := os.MkdirTemp("", "podman-bootc-test-keys")
+			Expect(err).To(Not(HaveOccurred()))
+			DeferCleanup(os.RemoveAll, keyDir)
+
+			var publicKey string
+			publicKey, registriesD, err = e2e.SignTestRegistryImage(keyDir)
+			Expect(err).To(Not(HaveOccurred()))
+
+			policy = filepath.Join(keyDir, "policy.json")
+			err = e2e.WriteSignaturePolicy(policy, publicKey)
+			Expect(err).To(Not(HaveOccurred()))
+		})
+
+		It("Should refuse to install an unsigned image", func() {
+			_, _, err := e2e.RunPodmanBootc("run", "-B", "--tls-verify=false", "--signature-policy", policy, "--registries-dir", registriesD, e2e.TestRegistryImageOne)
+			Expect(err).To(HaveOccurred())
+
+			vmDirs, err := e2e.ListCacheDirs()
+			Expect(err).To(Not(HaveOccurred()))
+			for _, vmDir := range vmDirs {
+				_, err = os.Stat(filepath.Join(vmDir, config.DiskImage))
+				Expect(os.IsNotExist(err)).To(BeTrue())
+			}
+		})
+
+		It("Should install a signed image and record the verification", func() {
+			_, _, err := e2e.RunPodmanBootc("run", "-B", "--tls-verify=false", "--signature-policy", policy, "--registries-dir", registriesD, e2e.TestRegistryImageSigned)
+			Expect(err).To(Not(HaveOccurred()))
+
+			vmId, err := e2e.GetVMIdFromContainerImage(e2e.TestRegistryImageSigned)
+			Expect(err).To(Not(HaveOccurred()))
+
+			stdout, _, err := e2e.RunPodmanBootc("inspect", vmId)
+			Expect(err).To(Not(HaveOccurred()))
+
+			var inspectOutput []struct {
+				DiskImage struct {
+					Verification *struct {
+						Reference string `json:"reference"`
+						Policy    string `json:"policy"`
+					} `json:"verification"`
+				}
+			}
+			err = json.Unmarshal([]byte(stdout), &inspectOutput)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(inspectOutput).To(HaveLen(1))
+			Expect(inspectOutput[0].DiskImage.Verification).To(Not(BeNil()))
+			Expect(inspectOutput[0].DiskImage.Verification.Reference).To(HavePrefix("localhost:5000/podman-bootc-test@sha256:"))
+			Expect(inspectOutput[0].DiskImage.Verification.Policy).To(Equal(policy))
+		})
+
+		AfterAll(func() {
+			err := e2e.StopTestRegistry()
+			Expect(err).To(Not(HaveOccurred()))
+			err = e2e.Cleanup()
+			if err != nil {
+				Fail(err.Error())
+			}
+		})
+	})
 })
@@ -14,6 +14,10 @@ import (
 const DefaultBaseImage = "quay.io/centos-bootc/centos-bootc-dev:stream9"
 const TestImageOne = "quay.io/ckyrouac/podman-bootc-test:one"
 const TestImageTwo = "quay.io/ckyrouac/podman-bootc-test:two"
+const TestRegistryImage = "docker.io/library/registry:2"
+const TestRegistryName = "podman-bootc-test-registry"
+const TestRegistryImageOne = "localhost:5000/podman-bootc-test:one"
+const TestRegistryImageSigned = "localhost:5000/podman-bootc-test:signed"
 
 var BaseImage = GetBaseImage()
 
@@ -140,6 +144,89 @@ func BootVM(image string) (vm *TestVM, err error) {
 	return
 }
 
+// StartTestRegistry runs a plain HTTP registry in the podman machine and pushes TestImageOne to it
+func StartTestRegistry() (err error) {
+	_, _, err = RunPodman("run", "-d", "--replace", "--name", TestRegistryName, "-p", "5000:5000", TestRegistryImage)
+	if err != nil {
+		return
+	}
+
+	_, _, err = RunPodman("pull", TestImageOne)
+	if err != nil {
+		return
+	}
+
+	_, _, err = RunPodman("push", "--tls-verify=false", TestImageOne, TestRegistryImageOne)
+	if err != nil {
+		return
+	}
+
+	_, _, err = RunPodman("rmi", TestImageOne, "-f")
+	return
+}
+
+// SignTestRegistryImage generates a sigstore key pair in keyDir, and copies TestRegistryImageOne
+// to TestRegistryImageSigned, signed with it. It requires skopeo on the host. It returns
+// the public key path, and the containers-registries.d(5) directory of keyDir storing the
+// signatures of the test registry images as sigstore attachments.
+func SignTestRegistryImage(keyDir string) (publicKey string, registriesD string, err error) {
+	registriesD = filepath.Join(keyDir, "registries.d")
+	if err = os.MkdirAll(registriesD, 0o755); err != nil {
+		return
+	}
+
+	err = os.WriteFile(filepath.Join(registriesD, "podman-bootc-test.yaml"), []byte("docker:\n  localhost:5000:\n    use-sigstore-attachments: true\n"), 0o644)
+	if err != nil {
+		return
+	}
+
+	passphraseFile := filepath.Join(keyDir, "passphrase")
+	if err = os.WriteFile(passphraseFile, []byte("podman-bootc-test"), 0o600); err != nil {
+		return
+	}
+
+	keyPrefix := filepath.Join(keyDir, "key")
+	_, _, err = RunCmd("skopeo", "generate-sigstore-key", "--output-prefix", keyPrefix, "--passphrase-file", passphraseFile)
+	if err != nil {
+		return
+	}
+
+	_, _, err = RunCmd("skopeo", "--registries.d", registriesD, "copy", "--src-tls-verify=false", "--dest-tls-verify=false",
+		"--sign-by-sigstore-private-key", keyPrefix+".private", "--sign-passphrase-file", passphraseFile,
+		"docker://"+TestRegistryImageOne, "docker://"+TestRegistryImageSigned)
+	if err != nil {
+		return
+	}
+
+	return keyPrefix + ".pub", registriesD, nil
+}
+
+// WriteSignaturePolicy writes a containers-policy.json(5) file accepting only the test
+// registry images signed by publicKey
+func WriteSignaturePolicy(path string, publicKey string) error {
+	policy := map[string]interface{}{
+		"default": []map[string]string{{"type": "reject"}},
+		"transports": map[string]interface{}{
+			"docker": map[string]interface{}{
+				"localhost:5000/podman-bootc-test": []map[string]string{
+					{"type": "sigstoreSigned", "keyPath": publicKey},
+				},
+			},
+		},
+	}
+
+	policyJson, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, policyJson, 0o644)
+}
+
+func StopTestRegistry() (err error) {
+	_, _, err = RunPodman("rm", "-f", TestRegistryName)
+	return
+}
+
 func Cleanup() (err error) {
 	_, _, err = RunPodmanBootc("rm", "--all", "-f")
 	if err != nil {
@@ -161,6 +248,16 @@ func Cleanup() (err error) {
 		return
 	}
 
+	_, _, err = RunPodman("rmi", TestRegistryImageOne, "-f")
+	if err != nil {
+		return
+	}
+
+	_, _, err = RunPodman("rmi", TestRegistryImageSigned, "-f")
+	if err != nil {
+		return
+	}
+
 	user, err := user.NewUser()
 	if err != nil {
 		return
@@ -171,9 +268,9 @@ func Cleanup() (err error) {
 }
 
 type ListEntry struct {
-	Id      string
-	Repo    string
-	Running string
+	Id    string
+	Repo  string
+	State string
 }
 
 // ParseListOutput parses the output of the podman bootc list command for easier comparison
@@ -191,9 +288,9 @@ func ParseListOutput(stdout string) (listOutput []ListEntry) {
 
 		entryArray := strings.Fields(line)
 		entry := ListEntry{
-			Id:      string(entryArray[0]),
-			Repo:    string(entryArray[1]),
-			Running: string(entryArray[len(entryArray)-2]),
+			Id:    string(entryArray[0]),
+			Repo:  string(entryArray[1]),
+			State: string(entryArray[len(entryArray)-2]),
 		}
 
 		listOutput = append(listOutput, entry)